@@ -4,26 +4,76 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/Tensai75/nzbsearcher/searcher"
 	"github.com/spf13/viper"
 )
 
+// ServerConfiguration
+type ServerConfiguration struct {
+	Host        string
+	Port        int
+	SSL         bool
+	User        string
+	Password    string
+	Connections int
+	Priority    int
+}
+
+// FilterConfiguration
+type FilterConfiguration struct {
+	Posters        string
+	ExcludePosters string
+	MinBytes       int64
+	MaxBytes       int64
+	MinFiles       int
+	Extensions     string
+	PostedFrom     string
+	PostedTo       string
+}
+
+// NZBConfiguration
+type NZBConfiguration struct {
+	Title      string
+	Category   string
+	Password   string
+	Provenance bool
+}
+
 // Configurations
 type Configurations struct {
-	Server struct {
-		Host        string
-		Port        int
-		SSL         bool
-		User        string
-		Password    string
-		Connections int
-	}
-	Groups        string
-	ParallelScans int
-	Step          int
-	Days          int
-	Path          string
-	Verbose       bool
+	Server             ServerConfiguration
+	Servers            []ServerConfiguration
+	Groups             string
+	Filter             FilterConfiguration
+	MinCompleteness    float64
+	Verify             bool
+	MergeCrossposts    bool
+	Newsgroups         bool
+	YEncNames          bool
+	Par2               bool
+	SubjectRules       string
+	DebugParser        bool
+	NZB                NZBConfiguration
+	Filename           string
+	Subdirectory       string
+	Overwrite          string
+	DropUnavailable    bool
+	ParallelScans      int
+	Step               int
+	ScanTolerance      int
+	Retries            int
+	RetryDelay         time.Duration
+	StateFile          string
+	CheckpointInterval time.Duration
+	IndexFile          string
+	DateCacheFile      string
+	Days               int
+	Timezone           string
+	Padding            time.Duration
+	Path               string
+	Verbose            bool
 }
 
 var conf Configurations
@@ -39,6 +89,14 @@ func loadConfig() error {
 	// Set config type to yaml
 	viper.SetConfigType("yaml")
 
+	// Set defaults for settings missing in configuration files of older versions
+	viper.SetDefault("Retries", 5)
+	viper.SetDefault("Padding", 24*time.Hour)
+	viper.SetDefault("NZB.Provenance", true)
+	viper.SetDefault("MergeCrossposts", true)
+	viper.SetDefault("Filename", defaultFilename)
+	viper.SetDefault("Overwrite", overwriteFiles)
+
 	if err := viper.ReadInConfig(); err != nil {
 		if strings.Contains(err.Error(), "Not Found") {
 			fmt.Printf("Config file \"config.yml\" not found. Creating config file...\n")
@@ -67,3 +125,76 @@ func loadConfig() error {
 
 	return nil
 }
+
+// servers returns the configured usenet servers, i.e. the server set with
+// "Server" (and the command line flags) followed by the ones listed under
+// "Servers".
+func servers() []searcher.Server {
+	var servers []searcher.Server
+	for _, server := range append([]ServerConfiguration{conf.Server}, conf.Servers...) {
+		if server.Host == "" {
+			continue
+		}
+		servers = append(servers, searcher.Server{
+			Host:        server.Host,
+			Port:        server.Port,
+			SSL:         server.SSL,
+			User:        server.User,
+			Password:    server.Password,
+			Connections: server.Connections,
+			Priority:    server.Priority,
+		})
+	}
+	return servers
+}
+
+// filter returns the configured filter for the headers found.
+func filter() (searcher.Filter, error) {
+	f := searcher.Filter{
+		Posters:        splitList(conf.Filter.Posters),
+		ExcludePosters: splitList(conf.Filter.ExcludePosters),
+		MinBytes:       conf.Filter.MinBytes,
+		MaxBytes:       conf.Filter.MaxBytes,
+		MinFiles:       conf.Filter.MinFiles,
+		Extensions:     splitList(conf.Filter.Extensions),
+	}
+	location, err := loadLocation(conf.Timezone)
+	if err != nil {
+		return f, fmt.Errorf("error loading time zone '%s': %w", conf.Timezone, err)
+	}
+	if conf.Filter.PostedFrom != "" {
+		if f.PostedFrom, err = parseDate(conf.Filter.PostedFrom, location); err != nil {
+			return f, fmt.Errorf("error parsing date '%s': %w", conf.Filter.PostedFrom, err)
+		}
+	}
+	if conf.Filter.PostedTo != "" {
+		if f.PostedTo, err = parseDate(conf.Filter.PostedTo, location); err != nil {
+			return f, fmt.Errorf("error parsing date '%s': %w", conf.Filter.PostedTo, err)
+		}
+	}
+	return f, nil
+}
+
+// subjectParser returns the parser for the subjects: the rules of the
+// subject rules file, if any, followed by the built-in parser.
+func subjectParser() (searcher.SubjectParser, error) {
+	if conf.SubjectRules == "" {
+		return searcher.DefaultParser, nil
+	}
+	rules, err := searcher.LoadSubjectRules(conf.SubjectRules)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.ParserChain{rules, searcher.DefaultParser}, nil
+}
+
+// splitList splits a list of values separated by commas.
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
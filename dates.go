@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// supported date formats, dates without a time zone are in the configured time zone
+var dateFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+}
+
+const dateFormatsHelp = "DD.MM.YYYY, YYYY-MM-DD, optionally followed by the time of day as hh:mm[:ss], or RFC3339 e.g. 2022-03-18T15:04:05+01:00"
+
+// parseDate parses date in one of the supported formats.
+func parseDate(date string, location *time.Location) (time.Time, error) {
+	date = strings.TrimSpace(date)
+	for _, format := range dateFormats {
+		if t, err := time.ParseInLocation(format, date, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format (supported formats: %s)", dateFormatsHelp)
+}
+
+// loadLocation returns the time zone dates without a time zone are in.
+// An empty name is UTC, "Local" is the time zone of the system.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
@@ -8,7 +8,23 @@ Server:
   SSL: false
   User: ""
   Password: ""
+  # maximum number of connections kept open to the server and reused for all requests
   Connections: 50
+  # servers with a lower priority value are tried first
+  Priority: 0
+
+# Additional usenet servers (e.g. block accounts on other backbones)
+# If a server does not carry a group, fails or does not reach back far enough,
+# the next server in order of priority is used for this group. If the server fails during the search,
+# the messages posted at the time of the failed messages are retrieved from the other servers
+# Servers:
+#   - Host: "news.example.com"
+#     Port: 563
+#     SSL: true
+#     User: ""
+#     Password: ""
+#     Connections: 20
+#     Priority: 1
 
 # Groups to be scanned
 # Possible values:
@@ -26,8 +42,106 @@ Path: ""
 
 # Number of days the search will go back from the date the header was posted
 # If left empty or commented out, the program will ask for the amount of days
+# Not used if the start of the date range is set with the parameter -from
 Days:
 
+# Time zone of dates entered without a time zone, e.g. "Europe/Berlin" or "Local" for the time zone of the system
+# If left empty or commented out, UTC is used
+Timezone: ""
+
+# Time added to the end of the date range for security, i.e. if the header was posted before the upload was finished
+# Set to 0 to scan narrow date ranges in very busy groups precisely
+Padding: 24h
+
+# Filters for the headers found, headers not passing all filters are not saved
+Filter:
+  # Patterns of which the poster must match at least one / none, separated by commas
+  # The patterns are matched against the whole poster, "*" matches any number of characters and "?" one character
+  # e.g. "*@example.com,poster*"
+  Posters: ""
+  ExcludePosters: ""
+  # Minimum and maximum total size of all messages of a header in bytes (0 for no limit)
+  MinBytes: 0
+  MaxBytes: 0
+  # Minimum number of files of a header
+  MinFiles: 0
+  # File extensions of which a header must contain at least one file each, separated by commas, e.g. ".par2,.nfo"
+  Extensions: ""
+  # Date range the header must have been posted in (in the same formats as the search dates)
+  # The header must have been posted before PostedTo. If left empty, no limit is applied
+  PostedFrom: ""
+  PostedTo: ""
+
+# Minimum completeness of a header in percent for the NZB file to be saved
+# The completeness is the share of the segments found of all segments given in the subjects of the messages
+MinCompleteness: 0
+
+# If set to true, the availability of all articles of the headers found is checked on the usenet server(s)
+# before the NZB files are saved. Files not completely available are flagged in the NZB file
+Verify: false
+
+# If set to true, files not completely available are removed from the NZB files instead of being flagged
+DropUnavailable: false
+
+# If set to true, headers cross-posted to several of the groups searched are merged into one NZB file
+# listing all groups. The NZB files are then saved once all groups have been searched
+MergeCrossposts: true
+
+# If set to true, the groups a header was cross-posted to are retrieved from the Newsgroups header of its articles
+# (one request per file) and added to the NZB file. Otherwise only the groups listed in the message overviews are added
+Newsgroups: false
+
+# If set to true, the names of the files are recovered from the yEnc headers of their first segments
+# (one request per file) and the files are grouped by these names. This groups the files of obfuscated posts
+# with random subjects correctly
+YEncNames: false
+
+# If set to true, the PAR2 index file of the headers found is downloaded and the files are renamed to the
+# names given in it. Files missing from the post and the expected and the found size are reported
+Par2: false
+
+# YAML file with rules to parse the subjects of the messages found, tried in order before the built-in parser.
+# Every rule is a regular expression with the named groups header, filename, fileNo, totalFiles, segmentNo and
+# totalSegments, e.g.
+#   rules:
+#     - name: bracketed
+#       pattern: '^\[(?P<fileNo>\d+)/(?P<totalFiles>\d+)\] - "(?P<filename>[^"]+)" yEnc \((?P<segmentNo>\d+)/(?P<totalSegments>\d+)\)'
+#   groups:
+#     alt.binaries.example:
+#       - name: bracketed
+#         pattern: ...
+# Rules under groups are tried first for these groups and replace the rules with the same name.
+# If left empty or commented out, only the built-in parser is used
+SubjectRules: ""
+
+# If set to true, the rule every subject was parsed with is shown
+DebugParser: false
+
+# Information written to the head of the NZB files, used by downloaders like SABnzbd
+NZB:
+  # Name of the download. If left empty, the name of the header is used
+  Title: ""
+  # Category of the download
+  Category: ""
+  # Password of the archives
+  Password: ""
+  # If set to true, the search query, the groups, the server and the date range are written as well
+  # The completeness report is always written
+  Provenance: true
+
+# Template for the names of the NZB files
+# Variables: {header}, {title}, {group}, {query}, {poster}, {date} (the post date, e.g. {date:2006-01-02} with a Go time layout)
+# and {partial} ("_partial" if the search was interrupted)
+# If several headers are searched with this default template, {query} is added after {header}
+Filename: "{header}_{group}{partial}.nzb"
+
+# Template for the subdirectory of the path the NZB files are saved to, with the same variables as Filename,
+# e.g. "{group}" or "{date:2006/01}". If left empty, the NZB files are saved directly to the path
+Subdirectory: ""
+
+# What to do if an NZB file already exists: "overwrite", "skip" or "suffix" (a number is added to the name)
+Overwrite: "overwrite"
+
 # Number of groups to scan in parallel
 ParallelScans: 200
 
@@ -36,6 +150,37 @@ ParallelScans: 200
 # Step x ParallelScans is the max number of message headers held in memory at one time, with each header consuming around 1 Kilobit of memory
 Step: 20000
 
+# Maximum number of messages scanned one by one when scanning a group for the first and the last message of the search
+# The messages are located by probing the group until the searched message is within this number of messages
+ScanTolerance: 1000
+
+# Number of times a failed header overview request is repeated before the messages are skipped
+Retries: 5
+
+# Delay before a failed request is repeated for the first time (e.g. "500ms", "2s")
+# The delay is doubled with every further retry
+RetryDelay: 1s
+
+# File the state of the search is saved to periodically, so an interrupted search can be resumed
+# with the parameter -resume <state file>. The file is deleted once the search has finished.
+# If left empty or commented out, no state is saved
+StateFile: "nzbsearcher.state"
+
+# Interval in which the state of the search is saved
+CheckpointInterval: 1m
+
+# Local index database of the message overviews retrieved from the usenet server(s)
+# Searches in groups and date ranges already indexed are done with the overviews from the index,
+# only overviews not yet in the index are retrieved from the usenet server. Searches fully covered by the index
+# are done without connecting to the usenet server at all.
+# The index can grow large for busy groups. If left empty or commented out, no index is used
+IndexFile: ""
+
+# File the dates of the messages found while scanning the groups for the start and the end of the search are cached in
+# Later searches in the same groups use the cached dates to find the start and the end of the search with only a few requests
+# If left empty or commented out, no cache is used
+DateCacheFile: "dates.json"
+
 # If set to true, additional information will be outputted
 Verbose: false`
 }
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Tensai75/nzbsearcher/searcher"
+	"github.com/kennygrant/sanitize"
+)
+
+const (
+	maxFilenameLength = 255
+	defaultFilename   = "{header}_{group}{partial}.nzb"
+	// default template if several headers are searched
+	defaultQueryFilename = "{header}_{query}_{group}{partial}.nzb"
+	defaultDateFormat    = "2006-01-02"
+)
+
+// policies for NZB files already existing
+const (
+	overwriteFiles = "overwrite"
+	skipFiles      = "skip"
+	suffixFiles    = "suffix"
+)
+
+// templateVariable matches the variables of the filename templates, e.g.
+// "{header}" or "{date:2006-01-02}".
+var templateVariable = regexp.MustCompile(`\{(\w+)(?::([^}]*))?\}`)
+
+// templateData holds the values of the variables of the filename templates.
+type templateData struct {
+	header  string
+	title   string
+	group   string
+	query   string
+	poster  string
+	date    time.Time
+	partial bool
+}
+
+// expandTemplate replaces the variables in template with their values.
+func expandTemplate(template string, data templateData) (string, error) {
+	var err error
+	expanded := templateVariable.ReplaceAllStringFunc(template, func(variable string) string {
+		match := templateVariable.FindStringSubmatch(variable)
+		switch match[1] {
+		case "header":
+			return data.header
+		case "title":
+			return data.title
+		case "group":
+			return data.group
+		case "query":
+			return data.query
+		case "poster":
+			return data.poster
+		case "date":
+			format := match[2]
+			if format == "" {
+				format = defaultDateFormat
+			}
+			return data.date.Format(format)
+		case "partial":
+			if data.partial {
+				return "_partial"
+			}
+			return ""
+		default:
+			err = fmt.Errorf("unknown variable '%s' in template '%s'", variable, template)
+			return variable
+		}
+	})
+	return expanded, err
+}
+
+// checkTemplates checks the filename templates and the overwrite policy.
+func checkTemplates() error {
+	if _, err := expandTemplate(conf.Filename, templateData{}); err != nil {
+		return err
+	}
+	if _, err := expandTemplate(conf.Subdirectory, templateData{}); err != nil {
+		return err
+	}
+	switch conf.Overwrite {
+	case overwriteFiles, skipFiles, suffixFiles:
+		return nil
+	}
+	return fmt.Errorf("unknown overwrite policy '%s'", conf.Overwrite)
+}
+
+// newTemplateData returns the values of the variables of the filename
+// templates for hdr found in group.
+func newTemplateData(hdr *searcher.Header, group string, meta searcher.NZBMeta) templateData {
+	data := templateData{
+		header:  hdr.Name,
+		title:   meta.Title,
+		group:   group,
+		query:   hdr.Query,
+		partial: meta.Partial,
+	}
+	if data.query == "" {
+		data.query = strings.Join(headersToSearch, ", ")
+	}
+	var date int64
+	for _, f := range hdr.FilesByHash {
+		data.poster = f.Poster
+		if f.Date > 0 && (date == 0 || f.Date < date) {
+			date = f.Date
+		}
+	}
+	data.date = time.Unix(date, 0).UTC()
+	return data
+}
+
+// filenameTemplate returns the template for the names of the NZB files. If
+// several headers are searched with the default template, the query is added
+// to it, so headers of the same name found by different queries are saved to
+// separate files.
+func filenameTemplate() string {
+	if conf.Filename == defaultFilename && len(headersToSearch) > 1 {
+		return defaultQueryFilename
+	}
+	return conf.Filename
+}
+
+// nzbPath returns the path of the NZB file for the template data, with the
+// subdirectories not yet created.
+func nzbPath(data templateData) (string, error) {
+	template := filenameTemplate()
+	filename, err := expandTemplate(template, data)
+	if err != nil {
+		return "", err
+	}
+	dir, err := expandTemplate(conf.Subdirectory, data)
+	if err != nil {
+		return "", err
+	}
+	path := conf.Path
+	for _, name := range strings.Split(filepath.ToSlash(dir), "/") {
+		if name = sanitize.Name(name); name != "" && name != "." && name != ".." {
+			path = filepath.Join(path, truncateFilename(name, maxFilenameLength))
+		}
+	}
+	filename = sanitize.Name(filename)
+	if filename == "" || filename == "." || filename == ".." {
+		return "", fmt.Errorf("the filename template '%s' results in an empty filename", template)
+	}
+	return filepath.Join(path, filename), nil
+}
+
+// truncateFilename shortens filename to at most max bytes, keeping its
+// extension and not cutting a UTF-8 encoded character in half.
+func truncateFilename(filename string, max int) string {
+	if len(filename) <= max {
+		return filename
+	}
+	ext := filepath.Ext(filename)
+	if len(ext) >= max {
+		ext = ""
+	}
+	return truncateUTF8(filename[:len(filename)-len(ext)], max-len(ext)) + ext
+}
+
+// truncateUTF8 shortens s to at most max bytes without cutting a UTF-8
+// encoded character in half.
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// createNZBFile creates the file at path according to the overwrite policy
+// and returns it together with its path, which differs from path if a
+// suffix was added. If the file exists and is to be skipped, nil is
+// returned.
+func createNZBFile(path string) (*os.File, string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, path, err
+	}
+	dir, filename := filepath.Split(path)
+	ext := filepath.Ext(filename)
+	for n := 1; ; n++ {
+		name := truncateFilename(filename, maxFilenameLength)
+		if n > 1 {
+			suffix := "_" + strconv.Itoa(n)
+			stem := truncateUTF8(strings.TrimSuffix(filename, ext), maxFilenameLength-len(suffix)-len(ext))
+			name = stem + suffix + ext
+		}
+		path = filepath.Join(dir, name)
+		if conf.Overwrite == overwriteFiles {
+			if _, err := os.Stat(path); err == nil {
+				fmt.Printf("Overwriting existing NZB file '%s'\n", path)
+			}
+			f, err := os.Create(path)
+			return f, path, err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return f, path, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, path, err
+		}
+		if conf.Overwrite == skipFiles {
+			return nil, path, nil
+		}
+	}
+}
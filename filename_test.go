@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{s: "abc", max: 5, want: "abc"},
+		{s: "abc", max: 2, want: "ab"},
+		// "é" is 2 bytes, "€" 3 bytes and "𝄞" 4 bytes long
+		{s: "aé", max: 2, want: "a"},
+		{s: "aé", max: 3, want: "aé"},
+		{s: "a€b", max: 3, want: "a"},
+		{s: "a€b", max: 4, want: "a€"},
+		{s: "𝄞𝄞", max: 7, want: "𝄞"},
+		{s: "𝄞", max: 3, want: ""},
+		{s: "é", max: 0, want: ""},
+	}
+	for _, test := range tests {
+		if got := truncateUTF8(test.s, test.max); got != test.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", test.s, test.max, got, test.want)
+		}
+	}
+}
+
+func TestTruncateFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		max      int
+		ext      string
+	}{
+		{name: "short", filename: "header.nzb", max: 255, ext: ".nzb"},
+		{name: "multi-byte rune at the cut", filename: "a" + strings.Repeat("€", 100) + ".nzb", max: 255, ext: ".nzb"},
+		{name: "4 byte runes", filename: strings.Repeat("𝄞", 80) + ".nzb", max: 255, ext: ".nzb"},
+		{name: "very long extension", filename: "header." + strings.Repeat("é", 200), max: 255},
+		{name: "extension as long as the maximum", filename: "a." + strings.Repeat("x", 253), max: 255, ext: "." + strings.Repeat("x", 253)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := truncateFilename(test.filename, test.max)
+			if len(got) > test.max {
+				t.Errorf("%q is %d bytes long, want at most %d", got, len(got), test.max)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("%q is not valid UTF-8", got)
+			}
+			if !strings.HasSuffix(got, test.ext) {
+				t.Errorf("%q does not end with %q", got, test.ext)
+			}
+			if len(test.filename) <= test.max && got != test.filename {
+				t.Errorf("%q was changed to %q", test.filename, got)
+			}
+		})
+	}
+}
+
+func TestCreateNZBFileSuffix(t *testing.T) {
+	conf.Overwrite = suffixFiles
+	dir := t.TempDir()
+	// a name longer than the maximum length of filenames, cut within "€"
+	path := filepath.Join(dir, "a"+strings.Repeat("€", 100)+".nzb")
+	names := make(map[string]bool)
+	for n := 1; n <= 11; n++ {
+		f, created, err := createNZBFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		name := filepath.Base(created)
+		if len(name) > maxFilenameLength || !utf8.ValidString(name) {
+			t.Errorf("created file %q of %d bytes", name, len(name))
+		}
+		suffix := ".nzb"
+		if n > 1 {
+			suffix = "_" + strconv.Itoa(n) + ".nzb"
+		}
+		if !strings.HasSuffix(name, suffix) {
+			t.Errorf("file %d is named %q, want suffix %q", n, name, suffix)
+		}
+		names[name] = true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 11 || len(names) != 11 {
+		t.Errorf("created %d files with %d names, want 11", len(entries), len(names))
+	}
+
+	conf.Overwrite = skipFiles
+	if f, _, err := createNZBFile(path); err != nil || f != nil {
+		t.Errorf("existing file not skipped: %v", err)
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/Tensai75/nzbsearcher/searcher"
 )
 
 const (
@@ -17,22 +20,13 @@ var (
 	ErrNoGroups = errors.New("no groups found")
 )
 
-func scanGroups(groupsString string) error {
+func scanGroups(ctx context.Context, s *searcher.Searcher, groupsString string) error {
 	if groupsString == allBinaryGroups || groupsString == allGroups {
-		if verbose {
-			fmt.Println("Connecting to usenet server to get groups list")
-		}
-		conn, err := ConnectNNTP()
-		defer DisconnectNNTP(conn)
-		if err != nil {
-			fmt.Printf("Error while connecting to usenet server: %v\n", err)
-			return ErrNoGroups
-		}
 		filter := ""
 		if groupsString == allBinaryGroups {
 			filter = "alt.binaries.*"
 		}
-		groupsList, err := conn.List("ACTIVE", filter)
+		groupsList, err := s.ListGroups(ctx, filter)
 		if err != nil {
 			fmt.Printf("Error while requesting list of groups: %v\n", err)
 			return ErrNoGroups
@@ -40,10 +34,7 @@ func scanGroups(groupsString string) error {
 		if verbose {
 			fmt.Println("Processing the groups")
 		}
-		for _, group := range groupsList {
-			groupData := strings.Split(string(group), " ")
-			groups = append(groups, groupData[0])
-		}
+		groups = append(groups, groupsList...)
 	} else if _, err := os.Stat(groupsString); err == nil {
 		if verbose {
 			fmt.Printf("Reading groups file '%s'\n", groupsString)
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// headersFlag is the repeatable -header flag.
+type headersFlag []string
+
+func (h *headersFlag) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headersFlag) Set(header string) error {
+	*h = append(*h, header)
+	return nil
+}
+
+// readHeaders adds the headers listed in the file at path, one per line, to
+// the headers to search for. Empty lines and lines starting with '#' are
+// skipped.
+func readHeaders(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		header := strings.TrimSpace(scanner.Text())
+		if header == "" || strings.HasPrefix(header, "#") {
+			continue
+		}
+		headersToSearch = append(headersToSearch, header)
+	}
+	return scanner.Err()
+}
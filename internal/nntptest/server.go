@@ -0,0 +1,453 @@
+package nntptest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault is an error injected into the responses of the server.
+type Fault struct {
+	// Command is the command the fault applies to, e.g. "OVER". The fault
+	// applies to all commands if empty.
+	Command string
+	// Args restricts the fault to commands with these arguments, e.g. a
+	// range of an OVER command. The fault applies to all arguments if
+	// empty.
+	Args string
+	// Times is the number of times the fault occurs, always if 0.
+	Times int
+	// Delay delays the response.
+	Delay time.Duration
+	// Drop closes the connection instead of responding.
+	Drop bool
+	// Code is the status code of the error response sent instead of the
+	// normal response, e.g. 436 or 502, with Message as text. The normal
+	// response is sent if 0.
+	Code    int
+	Message string
+}
+
+// Server is an NNTP server serving the articles of a store on the loopback
+// interface. It implements the commands CAPABILITIES, MODE READER,
+// AUTHINFO, GROUP, LIST (ACTIVE), OVER/XOVER, HEAD, BODY, STAT, DATE and
+// QUIT.
+type Server struct {
+	Store *Store
+	// User and Password are required to log in with AUTHINFO if User is
+	// not empty.
+	User     string
+	Password string
+	// Now is the time returned by the DATE command, the current time if
+	// zero.
+	Now time.Time
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mutex    sync.Mutex
+	faults   []*Fault
+	conns    map[net.Conn]bool
+	commands []string
+	closed   bool
+}
+
+// NewServer returns a running server for store listening on a random port
+// of the loopback interface. It must be closed with Close.
+func NewServer(store *Store) (*Server, error) {
+	s, err := NewUnstartedServer(store)
+	if err != nil {
+		return nil, err
+	}
+	s.Start()
+	return s, nil
+}
+
+// NewUnstartedServer returns a server for store listening on a random port
+// of the loopback interface, but not yet serving. Its settings can be
+// changed before it is started with Start. It must be closed with Close.
+func NewUnstartedServer(store *Store) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Store: store, listener: listener, conns: make(map[net.Conn]bool)}, nil
+}
+
+// Start starts serving connections.
+func (s *Server) Start() {
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// Host returns the host the server listens on.
+func (s *Server) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Inject adds a fault. Faults are checked in the order they were added and
+// the first matching fault is applied.
+func (s *Server) Inject(f Fault) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = nil
+}
+
+// Commands returns the commands received so far.
+func (s *Server) Commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// CountCommands returns the number of commands named command received so
+// far.
+func (s *Server) CountCommands(command string) int {
+	n := 0
+	for _, line := range s.Commands() {
+		if name, _ := splitCommand(line); name == command {
+			n++
+		}
+	}
+	return n
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() {
+	s.mutex.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mutex.Unlock()
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = true
+		s.mutex.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(c)
+			s.mutex.Lock()
+			delete(s.conns, c)
+			s.mutex.Unlock()
+			c.Close()
+		}()
+	}
+}
+
+// session is the state of a connection.
+type session struct {
+	w             *bufio.Writer
+	group         string
+	user          string
+	authenticated bool
+}
+
+func (s *Server) handle(c net.Conn) {
+	r := bufio.NewReader(c)
+	sess := &session{w: bufio.NewWriter(c), authenticated: s.User == ""}
+	sess.status(200, "nntptest server ready")
+	if sess.w.Flush() != nil {
+		return
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command, args := splitCommand(line)
+		s.mutex.Lock()
+		s.commands = append(s.commands, line)
+		s.mutex.Unlock()
+		if fault := s.fault(command, args); fault != nil {
+			time.Sleep(fault.Delay)
+			if fault.Drop {
+				return
+			}
+			if fault.Code != 0 {
+				sess.status(fault.Code, fault.Message)
+				if sess.w.Flush() != nil {
+					return
+				}
+				continue
+			}
+		}
+		quit := s.execute(sess, command, args)
+		if sess.w.Flush() != nil || quit {
+			return
+		}
+	}
+}
+
+// fault returns the first fault matching the command, if any.
+func (s *Server) fault(command, args string) *Fault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, f := range s.faults {
+		if f.Command != "" && f.Command != command || f.Args != "" && f.Args != args {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// splitCommand returns the upper case name and the arguments of a command
+// line.
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		return strings.ToUpper(line[:i]), strings.TrimSpace(line[i+1:])
+	}
+	return strings.ToUpper(line), ""
+}
+
+// execute runs a command and returns whether the connection is to be
+// closed.
+func (s *Server) execute(sess *session, command, args string) bool {
+	switch command {
+	case "QUIT":
+		sess.status(205, "bye")
+		return true
+	case "CAPABILITIES":
+		sess.status(101, "capability list follows")
+		sess.lines([]string{"VERSION 2", "READER", "OVER", "LIST ACTIVE", "AUTHINFO USER"})
+		return false
+	case "MODE":
+		sess.status(200, "reader mode")
+		return false
+	case "AUTHINFO":
+		s.authinfo(sess, args)
+		return false
+	}
+	if !sess.authenticated {
+		sess.status(480, "authentication required")
+		return false
+	}
+	switch command {
+	case "DATE":
+		now := s.Now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		sess.status(111, now.UTC().Format("20060102150405"))
+	case "GROUP":
+		count, low, high, ok := s.Store.group(args)
+		if !ok {
+			sess.status(411, "no such group")
+			return false
+		}
+		sess.group = args
+		sess.status(211, fmt.Sprintf("%d %d %d %s", count, low, high, args))
+	case "LIST":
+		s.list(sess, args)
+	case "OVER", "XOVER":
+		s.over(sess, args)
+	case "HEAD", "BODY", "STAT":
+		s.article(sess, command, args)
+	default:
+		sess.status(500, "unknown command")
+	}
+	return false
+}
+
+func (s *Server) authinfo(sess *session, args string) {
+	kind, value := splitCommand(args)
+	switch kind {
+	case "USER":
+		sess.user = value
+		if s.User == "" {
+			sess.status(281, "authentication accepted")
+			return
+		}
+		sess.status(381, "password required")
+	case "PASS":
+		if sess.user == s.User && value == s.Password {
+			sess.authenticated = true
+			sess.status(281, "authentication accepted")
+			return
+		}
+		sess.status(481, "authentication failed")
+	default:
+		sess.status(501, "syntax error")
+	}
+}
+
+func (s *Server) list(sess *session, args string) {
+	keyword, wildmat := splitCommand(args)
+	if keyword != "" && keyword != "ACTIVE" {
+		sess.status(501, "unsupported list")
+		return
+	}
+	var lines []string
+	for _, group := range s.Store.Groups() {
+		if wildmat != "" {
+			if ok, _ := path.Match(wildmat, group); !ok {
+				continue
+			}
+		}
+		_, low, high, _ := s.Store.group(group)
+		lines = append(lines, fmt.Sprintf("%s %d %d y", group, high, low))
+	}
+	sess.status(215, "list of newsgroups follows")
+	sess.lines(lines)
+}
+
+func (s *Server) over(sess *session, args string) {
+	if sess.group == "" {
+		sess.status(412, "no newsgroup selected")
+		return
+	}
+	_, _, high, _ := s.Store.group(sess.group)
+	first, last, ok := parseRange(args, high)
+	if !ok {
+		sess.status(501, "syntax error")
+		return
+	}
+	articles := s.Store.overview(sess.group, first, last)
+	if len(articles) == 0 {
+		sess.status(423, "no articles in that range")
+		return
+	}
+	lines := make([]string, len(articles))
+	for i, a := range articles {
+		lines[i] = strings.Join([]string{
+			strconv.Itoa(a.Number),
+			a.Subject,
+			a.From,
+			a.Date.Format(time.RFC1123Z),
+			"<" + a.MessageID + ">",
+			"",
+			strconv.Itoa(len(a.Body)),
+			strconv.Itoa(bytes.Count(a.Body, []byte("\n"))),
+			"Xref: nntptest " + xref(a),
+		}, "\t")
+	}
+	sess.status(224, "overview information follows")
+	sess.lines(lines)
+}
+
+// parseRange parses the range of an OVER command, "n", "n-" or "n-m".
+func parseRange(args string, high int) (int, int, bool) {
+	if args == "" {
+		return 0, 0, false
+	}
+	from, to := args, args
+	if i := strings.IndexByte(args, '-'); i >= 0 {
+		from, to = args[:i], args[i+1:]
+		if to == "" {
+			to = strconv.Itoa(high)
+		}
+	}
+	first, err := strconv.Atoi(from)
+	if err != nil {
+		return 0, 0, false
+	}
+	last, err := strconv.Atoi(to)
+	if err != nil {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+// xref returns the value of the Xref header of a, listing its number in
+// all its groups.
+func xref(a Article) string {
+	entries := make([]string, len(a.Groups))
+	for i, group := range a.Groups {
+		entries[i] = group + ":" + strconv.Itoa(a.Number)
+	}
+	return strings.Join(entries, " ")
+}
+
+func (s *Server) article(sess *session, command, args string) {
+	id := strings.Trim(args, "<>")
+	if id == args && sess.group == "" {
+		sess.status(412, "no newsgroup selected")
+		return
+	}
+	a, ok := s.Store.article(sess.group, id)
+	if !ok {
+		if id == args {
+			sess.status(423, "no article with that number")
+		} else {
+			sess.status(430, "no such article")
+		}
+		return
+	}
+	response := fmt.Sprintf("%d <%s>", a.Number, a.MessageID)
+	switch command {
+	case "STAT":
+		sess.status(223, response)
+	case "HEAD":
+		sess.status(221, response)
+		sess.lines([]string{
+			"From: " + a.From,
+			"Subject: " + a.Subject,
+			"Date: " + a.Date.Format(time.RFC1123Z),
+			"Message-ID: <" + a.MessageID + ">",
+			"Newsgroups: " + strings.Join(a.Groups, ","),
+			"Xref: nntptest " + xref(a),
+		})
+	case "BODY":
+		sess.status(222, response)
+		sess.lines(strings.Split(strings.TrimRight(strings.ReplaceAll(string(a.Body), "\r\n", "\n"), "\n"), "\n"))
+	}
+}
+
+func (sess *session) status(code int, text string) {
+	fmt.Fprintf(sess.w, "%d %s\r\n", code, text)
+}
+
+// lines writes a multi-line data block, dot-stuffed and terminated by a
+// line with a single dot.
+func (sess *session) lines(lines []string) {
+	for _, line := range lines {
+		if strings.HasPrefix(line, ".") {
+			sess.w.WriteString(".")
+		}
+		sess.w.WriteString(line)
+		sess.w.WriteString("\r\n")
+	}
+	sess.w.WriteString(".\r\n")
+}
@@ -0,0 +1,138 @@
+package nntptest
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Tensai75/nntp"
+)
+
+var testData = []byte("..data\n\r=\x00 of the post")
+
+func newTestServer(t *testing.T) (*Server, *nntp.Conn) {
+	store := NewStore()
+	start := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	store.AddFiller("alt.binaries.test", 1, 100, start, time.Minute)
+	store.AddPost("alt.binaries.test", Post{
+		Header:   "My.Post",
+		Files:    []PostFile{{Name: "my.post.rar", Data: testData}},
+		Date:     start.Add(2 * time.Hour),
+		Interval: time.Second,
+	})
+	server, err := NewUnstartedServer(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.User, server.Password = "user", "secret"
+	server.Start()
+	t.Cleanup(server.Close)
+	conn, err := nntp.Dial("tcp", server.Host()+":"+strconv.Itoa(server.Port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Quit() })
+	return server, conn
+}
+
+func TestServer(t *testing.T) {
+	server, conn := newTestServer(t)
+	if _, _, _, err := conn.Group("alt.binaries.test"); err == nil {
+		t.Fatal("GROUP succeeded without authentication")
+	}
+	if err := conn.Authenticate("user", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	count, low, high, err := conn.Group("alt.binaries.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 101 || low != 1 || high != 101 {
+		t.Errorf("GROUP returned %d %d %d, want 101 1 101", count, low, high)
+	}
+	server.Store.Expire("2.alt.binaries.test@nntptest")
+	overviews, err := conn.Overview(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overviews) != 2 || overviews[0].MessageNumber != 1 || overviews[1].MessageNumber != 3 {
+		t.Errorf("OVER returned %+v, want articles 1 and 3", overviews)
+	}
+	if _, _, err := conn.Stat("<2.alt.binaries.test@nntptest>"); !hasCode(err, 430) {
+		t.Errorf("STAT of expired article returned %v, want 430", err)
+	}
+	body, err := conn.Body("<101.alt.binaries.test@nntptest>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := string(EncodeYEnc("my.post.rar", testData, 1, 1, 0, int64(len(testData)))); string(data) != toLF(want) {
+		t.Errorf("BODY returned %q, want %q", data, toLF(want))
+	}
+	groups, err := conn.List("ACTIVE", "alt.binaries.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0] != "alt.binaries.test 101 1 y" {
+		t.Errorf("LIST ACTIVE returned %q", groups)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	server, conn := newTestServer(t)
+	if err := conn.Authenticate("user", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := conn.Group("alt.binaries.test"); err != nil {
+		t.Fatal(err)
+	}
+	server.Inject(Fault{Command: "OVER", Args: "1-10", Times: 1, Code: 436, Message: "temporary failure"})
+	server.Inject(Fault{Command: "STAT", Code: 502, Message: "permission denied"})
+	server.Inject(Fault{Command: "DATE", Delay: 50 * time.Millisecond})
+	if _, err := conn.Overview(1, 10); !hasCode(err, 436) {
+		t.Errorf("first OVER returned %v, want 436", err)
+	}
+	if _, err := conn.Overview(1, 10); err != nil {
+		t.Errorf("second OVER returned %v", err)
+	}
+	if _, _, err := conn.Stat("<1.alt.binaries.test@nntptest>"); !hasCode(err, 502) {
+		t.Errorf("STAT returned %v, want 502", err)
+	}
+	start := time.Now()
+	if _, err := conn.Date(); err != nil {
+		t.Errorf("DATE returned %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("DATE was not delayed")
+	}
+	server.ClearFaults()
+	server.Inject(Fault{Drop: true})
+	if _, err := conn.Date(); err == nil {
+		t.Error("DATE succeeded on dropped connection")
+	}
+	if n := server.CountCommands("OVER"); n != 2 {
+		t.Errorf("counted %d OVER commands, want 2", n)
+	}
+}
+
+func hasCode(err error, code uint) bool {
+	var nntpErr nntp.Error
+	return errors.As(err, &nntpErr) && nntpErr.Code == code
+}
+
+// toLF returns the lines of s as read by the NNTP client.
+func toLF(s string) string {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
@@ -0,0 +1,278 @@
+// Package nntptest provides an in-process NNTP server serving a synthetic
+// article store, with fault injection, for testing the searcher without a
+// Usenet account.
+package nntptest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Article is an article of the store.
+type Article struct {
+	Number    int
+	MessageID string // without angle brackets
+	Subject   string
+	From      string
+	Date      time.Time
+	// Groups are the groups the article was posted to, listed in its Xref
+	// and Newsgroups headers. The group it was added to is used if empty.
+	Groups []string
+	// Body is the body of the article, without dot-stuffing.
+	Body []byte
+	// Expired articles are listed in the group counts, but are missing
+	// from the overviews and cannot be retrieved.
+	Expired bool
+}
+
+// Store is a set of groups with their articles. It is safe for concurrent
+// use.
+type Store struct {
+	mutex    sync.RWMutex
+	groups   map[string][]*Article
+	articles map[string]*Article
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{
+		groups:   make(map[string][]*Article),
+		articles: make(map[string]*Article),
+	}
+}
+
+// Add adds the articles to group. Articles without a number are numbered
+// after the last article of the group and articles without a message id
+// get one from their number and group.
+func (s *Store) Add(group string, articles ...*Article) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	list := s.groups[group]
+	for _, a := range articles {
+		if a.Number == 0 {
+			a.Number = 1
+			if len(list) > 0 {
+				a.Number = list[len(list)-1].Number + 1
+			}
+		}
+		if a.MessageID == "" {
+			a.MessageID = fmt.Sprintf("%d.%s@nntptest", a.Number, group)
+		}
+		if len(a.Groups) == 0 {
+			a.Groups = []string{group}
+		}
+		if a.From == "" {
+			a.From = "poster@example.com"
+		}
+		list = append(list, a)
+		s.articles[a.MessageID] = a
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	s.groups[group] = list
+}
+
+// AddFiller adds count articles with random subjects to group, starting at
+// start and posted every interval. The dates are jittered by up to a tenth
+// of interval and about one in 50 articles has a wrong date, like on real
+// servers. The articles are the same for the same seed.
+func (s *Store) AddFiller(group string, seed int64, count int, start time.Time, interval time.Duration) {
+	random := rand.New(rand.NewSource(seed))
+	articles := make([]*Article, count)
+	for i := range articles {
+		date := start.Add(time.Duration(i) * interval)
+		if jitter := int64(interval / 10); jitter > 0 {
+			date = date.Add(time.Duration(random.Int63n(2*jitter+1) - jitter))
+		}
+		if random.Intn(50) == 0 {
+			date = date.Add(-time.Duration(random.Intn(30)+1) * 24 * time.Hour)
+		}
+		words := make([]string, 3)
+		for j := range words {
+			words[j] = fillerWords[random.Intn(len(fillerWords))]
+		}
+		articles[i] = &Article{
+			Subject: fmt.Sprintf("%s %d", strings.Join(words, " "), random.Intn(10000)),
+			From:    fmt.Sprintf("user%d@example.com", random.Intn(20)),
+			Date:    date.UTC(),
+			Body:    []byte("filler\r\n"),
+		}
+	}
+	s.Add(group, articles...)
+}
+
+var fillerWords = []string{"lorem", "ipsum", "dolor", "sit", "amet", "random", "post", "discussion", "question", "answer"}
+
+// PostFile is a file of a post.
+type PostFile struct {
+	Name string
+	Data []byte
+}
+
+// Post is a binary post of several files, split into yEnc encoded segments.
+type Post struct {
+	// Header is the part of the subjects before the file number.
+	Header string
+	From   string
+	Files  []PostFile
+	// SegmentSize is the size of the segments, 1000 bytes if 0.
+	SegmentSize int
+	// Date is the date of the first segment, the others follow every
+	// Interval.
+	Date     time.Time
+	Interval time.Duration
+	// Groups are the groups the post is cross-posted to.
+	Groups []string
+}
+
+// AddPost adds the segments of the post to group, with subjects like
+// `Header [1/3] - "file.rar" yEnc (1/12)`, and returns their articles.
+func (s *Store) AddPost(group string, post Post) []*Article {
+	size := post.SegmentSize
+	if size <= 0 {
+		size = 1000
+	}
+	var articles []*Article
+	date := post.Date
+	for i, f := range post.Files {
+		total := (len(f.Data) + size - 1) / size
+		if total == 0 {
+			total = 1
+		}
+		for part := 1; part <= total; part++ {
+			begin := (part - 1) * size
+			end := begin + size
+			if end > len(f.Data) {
+				end = len(f.Data)
+			}
+			subject := fmt.Sprintf(`%s [%d/%d] - "%s" yEnc (%d/%d)`, post.Header, i+1, len(post.Files), f.Name, part, total)
+			articles = append(articles, &Article{
+				Subject: strings.TrimSpace(subject),
+				From:    post.From,
+				Date:    date.UTC(),
+				Groups:  post.Groups,
+				Body:    EncodeYEnc(f.Name, f.Data[begin:end], part, total, int64(begin), int64(len(f.Data))),
+			})
+			date = date.Add(post.Interval)
+		}
+	}
+	s.Add(group, articles...)
+	return articles
+}
+
+// Expire marks the articles with the message ids as expired. Expired
+// articles are missing from the overviews and cannot be retrieved.
+func (s *Store) Expire(messageIDs ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range messageIDs {
+		if a, ok := s.articles[id]; ok {
+			a.Expired = true
+		}
+	}
+}
+
+// Articles returns the articles of group, including the expired ones.
+func (s *Store) Articles(group string) []*Article {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]*Article(nil), s.groups[group]...)
+}
+
+// Groups returns the names of the groups of the store, sorted.
+func (s *Store) Groups() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	groups := make([]string, 0, len(s.groups))
+	for group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// group returns the number of articles, the lowest and the highest article
+// number of group and whether the group exists.
+func (s *Store) group(name string) (count, low, high int, ok bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	articles, ok := s.groups[name]
+	if len(articles) == 0 {
+		return 0, 1, 0, ok
+	}
+	return len(articles), articles[0].Number, articles[len(articles)-1].Number, ok
+}
+
+// overview returns copies of the articles of group numbered first to last
+// which are not expired.
+func (s *Store) overview(group string, first, last int) []Article {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var articles []Article
+	for _, a := range s.groups[group] {
+		if a.Number >= first && a.Number <= last && !a.Expired {
+			articles = append(articles, *a)
+		}
+	}
+	return articles
+}
+
+// article returns a copy of the article with the message id or, if
+// messageID is a number, of the article with this number in group. ok is
+// false if there is no such article or it is expired.
+func (s *Store) article(group string, messageID string) (Article, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if number, err := strconv.Atoi(messageID); err == nil {
+		for _, a := range s.groups[group] {
+			if a.Number == number && !a.Expired {
+				return *a, true
+			}
+		}
+		return Article{}, false
+	}
+	if a, ok := s.articles[messageID]; ok && !a.Expired {
+		return *a, true
+	}
+	return Article{}, false
+}
+
+// EncodeYEnc returns the yEnc encoded body of part of total of a file with
+// the name and size, whose data starts at offset begin.
+func EncodeYEnc(name string, data []byte, part, total int, begin, size int64) []byte {
+	var b strings.Builder
+	if total > 1 {
+		fmt.Fprintf(&b, "=ybegin part=%d total=%d line=128 size=%d name=%s\r\n", part, total, size, name)
+		fmt.Fprintf(&b, "=ypart begin=%d end=%d\r\n", begin+1, begin+int64(len(data)))
+	} else {
+		fmt.Fprintf(&b, "=ybegin line=128 size=%d name=%s\r\n", size, name)
+	}
+	column := 0
+	for _, c := range data {
+		e := c + 42
+		switch e {
+		case 0, '\n', '\r', '=':
+			b.WriteByte('=')
+			e += 64
+			column++
+		}
+		b.WriteByte(e)
+		if column++; column >= 128 {
+			b.WriteString("\r\n")
+			column = 0
+		}
+	}
+	if column > 0 {
+		b.WriteString("\r\n")
+	}
+	if total > 1 {
+		fmt.Fprintf(&b, "=yend size=%d part=%d\r\n", len(data), part)
+	} else {
+		fmt.Fprintf(&b, "=yend size=%d\r\n", len(data))
+	}
+	return []byte(b.String())
+}
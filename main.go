@@ -2,55 +2,204 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"github.com/Tensai75/nzbsearcher/searcher"
 )
 
 var (
-	counter   uint64
-	waitGroup sync.WaitGroup
-
 	// search variables
-	headerToSearch string
-	groups         []string
-	postDateUnix   int64
-	days           int
+	headersToSearch headersFlag
+	groupsFlag      string
+	groups          []string
+	from            time.Time
+	to              time.Time
+	searchFilter    searcher.Filter
+	parser          searcher.SubjectParser
+
+	// search state
+	stateFile   string
+	resumeFile  string
+	resumeState *searcher.State
+
+	// command is the subcommand to run instead of a search
+	command string
+	// parseGroup is the group the subjects of the parse command were
+	// posted to
+	parseGroup string
 
 	verbose bool
 )
 
+// subcommands
+const (
+	verifyCommand = "verify"
+	parseCommand  = "parse"
+)
+
 func main() {
+	setup()
 	start := time.Now()
 
-	guard := make(chan struct{}, conf.ParallelScans)
+	// cancel the search on Ctrl+C, a second Ctrl+C terminates immediately
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println("Interrupting search, saving the results found so far (press Ctrl+C again to quit immediately)")
+		cancel()
+		<-signals
+		os.Exit(1)
+	}()
 
-	for _, group := range groups {
-		guard <- struct{}{} // will block if guard channel is already filled
-		waitGroup.Add(1)
-		go func(group string) {
-			defer func() {
-				waitGroup.Done()
-				<-guard
-			}()
-
-			if err := search(group); err != nil {
-				fmt.Printf("Error searching in group '%s': %v\n", group, err)
+	if command == verifyCommand {
+		os.Exit(verifyNZBs(ctx, flag.Args()))
+	}
+	if command == parseCommand {
+		os.Exit(parseSubjects(flag.Args()))
+	}
+
+	var index *searcher.Index
+	if conf.IndexFile != "" {
+		var err error
+		if index, err = searcher.OpenIndex(conf.IndexFile); err != nil {
+			fmt.Printf("Error opening index '%s': %v\n", conf.IndexFile, err)
+			os.Exit(1)
+		}
+		defer index.Close()
+		if verbose {
+			fmt.Printf("Using index '%s'\n", conf.IndexFile)
+		}
+	}
+
+	var dateCache *searcher.DateCache
+	if conf.DateCacheFile != "" {
+		var err error
+		if dateCache, err = searcher.LoadDateCache(conf.DateCacheFile); err != nil {
+			fmt.Printf("Error loading date cache '%s': %v\n", conf.DateCacheFile, err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := dateCache.Save(); err != nil {
+				fmt.Printf("Error saving date cache '%s': %v\n", conf.DateCacheFile, err)
+			}
+		}()
+	}
+
+	s, err := searcher.New(searcher.Options{
+		Servers:            servers(),
+		Headers:            headersToSearch,
+		From:               from,
+		To:                 to,
+		Filter:             searchFilter,
+		Parser:             parser,
+		DebugParser:        conf.DebugParser,
+		Step:               conf.Step,
+		ParallelScans:      conf.ParallelScans,
+		ScanTolerance:      conf.ScanTolerance,
+		Retries:            conf.Retries,
+		RetryDelay:         conf.RetryDelay,
+		StateFile:          stateFile,
+		CheckpointInterval: conf.CheckpointInterval,
+		Resume:             resumeState,
+		Index:              index,
+		DateCache:          dateCache,
+		Verbose:            verbose,
+		Logf:               logf,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer s.Close()
+
+	// force user to input groups if not already done
+	for len(groups) == 0 && ctx.Err() == nil {
+		var err error
+		if groupsFlag != "" {
+			err = scanGroups(ctx, s, groupsFlag)
+			groupsFlag = ""
+		} else {
+			fmt.Print("Enter group name(s) to search in: ")
+			err = scanGroups(ctx, s, inputReader())
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+
+	// with cross-posts merged, the NZB files are saved once all groups
+	// have been searched
+	var (
+		mutex   sync.Mutex
+		results []searcher.GroupResult
+	)
+	s.SearchGroups(ctx, groups, func(result searcher.GroupResult) {
+		if result.Err != nil && !result.Partial {
+			fmt.Printf("Error searching in group '%s': %v\n", result.Group, result.Err)
+			return
+		}
+		if len(result.Headers) == 0 {
+			fmt.Printf("Header not found in group %s!\n", result.Group)
+			return
+		}
+		for _, hdr := range result.Headers {
+			if len(headersToSearch) > 1 {
+				fmt.Printf("Found header '%s' for '%s' in group '%s'\n", hdr.Name, hdr.Query, result.Group)
+			} else {
+				fmt.Printf("Found header '%s' in group '%s'\n", hdr.Name, result.Group)
 			}
-		}(group)
+		}
+		if conf.MergeCrossposts {
+			mutex.Lock()
+			results = append(results, result)
+			mutex.Unlock()
+			return
+		}
+		headers := result.Headers
+		if conf.YEncNames {
+			headers = s.RecoverFilenames(ctx, headers)
+		}
+		for _, hdr := range headers {
+			saveHeader(ctx, s, hdr, result.Group, []searcher.GroupResult{result})
+		}
+	})
+	if conf.MergeCrossposts {
+		saveMergedHeaders(ctx, s, results)
+	}
+
+	printGroupServers(s.GroupServers())
+	printFailedRanges(s.FailedRanges())
+
+	if stateFile != "" {
+		if ctx.Err() == nil && len(s.FailedRanges()) == 0 {
+			os.Remove(stateFile)
+		} else {
+			fmt.Printf("The search can be resumed with: -resume \"%s\"\n", stateFile)
+		}
 	}
-	waitGroup.Wait()
 
 	duration := time.Since(start)
-	perSecond := float64(counter) / duration.Seconds()
-	fmt.Printf("A total of %d messages were processed in %v (%d Messages/s)\n", counter, duration, int(perSecond))
+	perSecond := float64(s.Processed()) / duration.Seconds()
+	fmt.Printf("A total of %d messages were processed in %v (%d Messages/s)\n", s.Processed(), duration, int(perSecond))
 }
 
-func init() {
+// setup loads the configuration and parses the command line. The search
+// parameters not given are read from the input.
+func setup() {
 
 	// load configuration
 	if err := loadConfig(); err != nil {
@@ -59,20 +208,52 @@ func init() {
 	}
 
 	var (
-		date       string
-		groupsFlag string
-		path       string
+		date        string
+		headersFile string
+		fromFlag    string
+		toFlag      string
+		path        string
 	)
 
 	// flags
-	flag.StringVar(&headerToSearch, "header", "", "the header to search for")
-	flag.StringVar(&date, "date", "", "the date the header was posted (in the format DD.MM.YYYY or YYYY-MM-dd)")
+	flag.Var(&headersToSearch, "header", "the header to search for (can be repeated to search for several headers at once), e.g. 'my.show AND (720p OR 1080p) NOT sample' (words and \"phrases\" combined with AND, OR, NOT and parentheses, * and ? as wildcards, re:<regexp> for regular expressions, headers without AND, OR, NOT, quotes or re: are searched for literally)")
+	flag.StringVar(&headersFile, "headers", "", "a file listing headers to search for, one per line")
+	flag.StringVar(&date, "date", "", "the date the header was posted ("+dateFormatsHelp+"), same as -to")
+	flag.StringVar(&fromFlag, "from", "", "the start of the date range to search ("+dateFormatsHelp+")\nif not set, the search starts the number of days set with -days before the end of the date range")
+	flag.StringVar(&toFlag, "to", "", "the end of the date range to search ("+dateFormatsHelp+")\nthe padding is added to this date")
+	flag.StringVar(&conf.Timezone, "timezone", conf.Timezone, "the time zone of dates entered without time zone, e.g. 'Europe/Berlin' or 'Local' (default UTC)")
+	flag.DurationVar(&conf.Padding, "padding", conf.Padding, "the time added to the end of the date range for security, i.e. if the header was posted before the upload was finished")
 	flag.StringVar(&groupsFlag, "groups", conf.Groups, `the group(s) to search in (separated by commas)
 if set to an existing file, the groups listed in this file will be scanned (each group name must be on a separate line)
 if set to 'ALL' all available groups on the usenet server will be scanned
 if set to 'BINARIES' all available alt.binaries.* groups on the usenet server will be scanned`)
+	flag.StringVar(&conf.Filter.Posters, "posters", conf.Filter.Posters, "only save headers posted by a poster matching one of these patterns (separated by commas, * and ? as wildcards)")
+	flag.StringVar(&conf.Filter.ExcludePosters, "excludeposters", conf.Filter.ExcludePosters, "do not save headers posted by a poster matching one of these patterns (separated by commas, * and ? as wildcards)")
+	flag.Int64Var(&conf.Filter.MinBytes, "minbytes", conf.Filter.MinBytes, "the minimum total size of a header in bytes")
+	flag.Int64Var(&conf.Filter.MaxBytes, "maxbytes", conf.Filter.MaxBytes, "the maximum total size of a header in bytes (0 for no limit)")
+	flag.IntVar(&conf.Filter.MinFiles, "minfiles", conf.Filter.MinFiles, "the minimum number of files of a header")
+	flag.StringVar(&conf.Filter.Extensions, "extensions", conf.Filter.Extensions, "file extensions a header must contain a file of each (separated by commas), e.g. '.par2'")
+	flag.StringVar(&conf.Filter.PostedFrom, "postedfrom", conf.Filter.PostedFrom, "only save headers posted at or after this date ("+dateFormatsHelp+")")
+	flag.StringVar(&conf.Filter.PostedTo, "postedto", conf.Filter.PostedTo, "only save headers posted before this date ("+dateFormatsHelp+")")
+	flag.Float64Var(&conf.MinCompleteness, "mincompleteness", conf.MinCompleteness, "the minimum completeness of a header in percent for the NZB file to be saved")
+	flag.BoolVar(&conf.Verify, "verify", conf.Verify, "check the availability of all articles of the headers found on the usenet server(s) before saving the NZB files")
+	flag.BoolVar(&conf.DropUnavailable, "dropunavailable", conf.DropUnavailable, "remove files not completely available on the usenet server(s) from the NZB files (only with -verify)")
+	flag.StringVar(&conf.NZB.Title, "title", conf.NZB.Title, "the title written to the NZB files (default the name of the header)")
+	flag.StringVar(&conf.NZB.Category, "category", conf.NZB.Category, "the category written to the NZB files")
+	flag.StringVar(&conf.NZB.Password, "nzbpassword", conf.NZB.Password, "the password of the archives written to the NZB files")
+	flag.BoolVar(&conf.NZB.Provenance, "provenance", conf.NZB.Provenance, "write the search query, groups, server, date range and completeness to the NZB files")
+	flag.BoolVar(&conf.MergeCrossposts, "merge", conf.MergeCrossposts, "merge headers cross-posted to several of the groups searched into one NZB file")
+	flag.BoolVar(&conf.Newsgroups, "newsgroups", conf.Newsgroups, "retrieve the groups a header was cross-posted to from the Newsgroups header of its articles")
+	flag.StringVar(&conf.Filename, "filename", conf.Filename, "the template for the names of the NZB files, e.g. '{header}_{date:2006-01-02}_{poster}.nzb'\nvariables: {header}, {title}, {group}, {query}, {poster}, {date} or {date:<Go time layout>} (the post date), {partial} ('_partial' for interrupted searches)")
+	flag.StringVar(&conf.Subdirectory, "subdir", conf.Subdirectory, "the template for the subdirectory of the path the NZB files are saved to, e.g. '{group}' or '{date:2006/01}' (same variables as -filename)")
+	flag.StringVar(&conf.Overwrite, "overwrite", conf.Overwrite, "what to do if an NZB file already exists: 'overwrite', 'skip' or 'suffix' (add a number to the name)")
+	flag.BoolVar(&conf.YEncNames, "yenc", conf.YEncNames, "recover the names of the files from the yEnc headers of their first segments (one request per file) and group obfuscated posts by these names")
+	flag.BoolVar(&conf.Par2, "par2", conf.Par2, "download the PAR2 index file of the headers found, rename the files to the names given in it and report the files missing")
+	flag.StringVar(&conf.SubjectRules, "rules", conf.SubjectRules, "the YAML file with the rules to parse the subjects with before the built-in parser is tried")
+	flag.BoolVar(&conf.DebugParser, "debugparser", conf.DebugParser, "show the rule every subject was parsed with")
+	flag.StringVar(&parseGroup, "group", "", "the group the subjects given to the parse command were posted to (selects the rules for this group)")
 	flag.StringVar(&path, "path", conf.Path, "the path where the NZB file will be saved to")
-	flag.IntVar(&conf.Days, "days", conf.Days, "the number of days to search back from the post date")
+	flag.IntVar(&conf.Days, "days", conf.Days, "the number of days to search back from the end of the date range")
 	flag.StringVar(&conf.Server.Host, "host", conf.Server.Host, "the usenet server host name")
 	flag.IntVar(&conf.Server.Port, "port", conf.Server.Port, "the port for the usenet server")
 	flag.BoolVar(&conf.Server.SSL, "ssl", conf.Server.SSL, "connect via SSL")
@@ -81,50 +262,142 @@ if set to 'BINARIES' all available alt.binaries.* groups on the usenet server wi
 	flag.IntVar(&conf.Server.Connections, "conn", conf.Server.Connections, "the number of connections to use")
 	flag.IntVar(&conf.ParallelScans, "scans", conf.ParallelScans, "the number of groups to scan in parallel")
 	flag.IntVar(&conf.Step, "step", conf.Step, "the number of message headers to retrieve in one header overview request")
+	flag.IntVar(&conf.ScanTolerance, "tolerance", conf.ScanTolerance, "the maximum number of messages scanned one by one to find the start and the end of the search")
+	flag.IntVar(&conf.Retries, "retries", conf.Retries, "the number of times a failed header overview request is repeated")
+	flag.StringVar(&stateFile, "state", conf.StateFile, "the file the state of the search is saved to periodically so the search can be resumed")
+	flag.StringVar(&conf.IndexFile, "index", conf.IndexFile, "the local index database of message overviews (no index is used if empty)")
+	flag.StringVar(&conf.DateCacheFile, "datecache", conf.DateCacheFile, "the file the dates of scanned messages are cached in (no cache is used if empty)")
+	flag.StringVar(&resumeFile, "resume", "", "the state file of an interrupted search to resume")
 	flag.BoolVar(&verbose, "verbose", conf.Verbose, "show verbose output")
-	flag.Parse()
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %[1]s [flags]\n       %[1]s verify [flags] file.nzb [file.nzb ...]\n       %[1]s parse [flags] [subject ...]\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == verifyCommand || args[0] == parseCommand) {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if command != "" {
+		return
+	}
+
+	if resumeFile != "" {
+		resumeSearch()
+	} else {
+		if headersFile != "" {
+			if err := readHeaders(headersFile); err != nil {
+				fmt.Printf("Error while reading headers file '%s': %v\n", headersFile, err)
+				os.Exit(1)
+			}
+		}
+		if toFlag == "" {
+			toFlag = date
+		}
+		readSearchParameters(fromFlag, toFlag)
+	}
+
+	// set filter
+	var err error
+	if searchFilter, err = filter(); err != nil {
+		fmt.Printf("Error in filter: %v\n", err)
+		os.Exit(1)
+	}
+
+	// set subject parser
+	if parser, err = subjectParser(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := checkTemplates(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// set path
+	if path == "" {
+		path = "./"
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Printf("Error for path '%s': %v\n", path, err)
+		os.Exit(1)
+	}
+	if verbose {
+		fmt.Printf("Setting path for NZB files to: %s\n", path)
+	}
+	conf.Path = path
+}
+
+// resumeSearch loads the state file of an interrupted search and takes the
+// search parameters from it.
+func resumeSearch() {
+	var err error
+	if resumeState, err = searcher.LoadState(resumeFile); err != nil {
+		fmt.Printf("Error loading state file '%s': %v\n", resumeFile, err)
+		os.Exit(1)
+	}
+	headersToSearch = resumeState.Headers
+	from = resumeState.From
+	to = resumeState.To
+	groups = resumeState.Groups
+	stateFile = resumeFile
+	fmt.Printf("Resuming search for header(s) '%s' in %d group(s)\n", strings.Join(headersToSearch, "', '"), len(groups))
+}
+
+// readSearchParameters asks the user for all search parameters not set by
+// the command line flags or the configuration file.
+func readSearchParameters(fromFlag string, toFlag string) {
+	location, err := loadLocation(conf.Timezone)
+	if err != nil {
+		fmt.Printf("Error loading time zone '%s': %v\n", conf.Timezone, err)
+		os.Exit(1)
+	}
 
 	// force user to enter header if not already done
-	for headerToSearch == "" {
+	for len(headersToSearch) == 0 {
 		fmt.Print("Enter header to search for: ")
-		headerToSearch = inputReader()
+		if header := inputReader(); header != "" {
+			headersToSearch = append(headersToSearch, header)
+		}
 	}
 
 	// force user to input groups if not already done
-	for len(groups) == 0 {
-		var err error
-		if groupsFlag != "" {
-			err = scanGroups(groupsFlag)
-		} else {
-			fmt.Print("Enter group name(s) to search in: ")
-			err = scanGroups(inputReader())
-		}
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
+	for groupsFlag == "" {
+		fmt.Print("Enter group name(s) to search in: ")
+		groupsFlag = inputReader()
 	}
 
 	// force user to input date if not already done
 	for {
-		if date == "" {
+		if toFlag == "" {
 			fmt.Print("Enter the date when the header was posted (DD.MM.YYYY or YYYY-MM-dd): ")
-			date = strings.TrimSpace(inputReader())
+			toFlag = strings.TrimSpace(inputReader())
 		}
-		d, err := time.Parse("02.01.2006", date)
+		d, err := parseDate(toFlag, location)
 		if err != nil {
-			d, err = time.Parse("2006-01-02", date)
-			if err != nil {
-				fmt.Printf("Error parsing date '%s': %s\n", date, err)
-				continue
-			}
+			fmt.Printf("Error parsing date '%s': %s\n", toFlag, err)
+			toFlag = ""
+			continue
 		}
-		postDateUnix = d.Add(24 * time.Hour).Unix() // add a day for security, i.e. if it was posted before upload was finished
+		to = d
 		break
 	}
 
-	// force user to enter search range
-	days = conf.Days
-	for days == 0 {
+	// force user to enter search range if no start date is set
+	for fromFlag != "" {
+		d, err := parseDate(fromFlag, location)
+		if err != nil {
+			fmt.Printf("Error parsing date '%s': %s\n", fromFlag, err)
+			fmt.Print("Enter the start of the date range to search: ")
+			fromFlag = strings.TrimSpace(inputReader())
+			continue
+		}
+		from = d
+		break
+	}
+	days := conf.Days
+	for from.IsZero() && days == 0 {
 		var input string
 		fmt.Print("Enter the amount of days to search back: ")
 		input = strings.TrimSpace(inputReader())
@@ -132,22 +405,54 @@ if set to 'BINARIES' all available alt.binaries.* groups on the usenet server wi
 		if err != nil {
 			fmt.Printf("Error parsing input '%s': %s\n", input, err)
 		} else {
-			days = result + 1 // add back the day which was added above for security to have full length of back search
+			days = result
 		}
 	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -days)
+	}
 
-	// set path
-	if path == "" {
-		path = "./"
+	// add the padding for security, i.e. if the header was posted before upload was finished
+	to = to.Add(conf.Padding)
+	if verbose {
+		fmt.Printf("Searching messages posted from %s to %s\n", from, to)
 	}
-	if _, err := os.Stat(path); err != nil {
-		fmt.Printf("Error for path '%s': %v\n", path, err)
-		os.Exit(1)
+}
+
+func printGroupServers(groupServers map[string]searcher.Server) {
+	if len(servers()) < 2 || len(groupServers) == 0 {
+		return
 	}
-	if verbose {
-		fmt.Printf("Setting path for NZB files to: %s\n", path)
+	fmt.Println("The groups were searched on the following servers:")
+	groups := make([]string, 0, len(groupServers))
+	for group := range groupServers {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		fmt.Printf("  %s: %s\n", group, groupServers[group])
+	}
+}
+
+func printFailedRanges(failedRanges map[string][]searcher.Range) {
+	if len(failedRanges) == 0 {
+		return
+	}
+	fmt.Println("The following messages could not be retrieved from the usenet server, the results may be incomplete:")
+	groups := make([]string, 0, len(failedRanges))
+	for group := range failedRanges {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		ranges := failedRanges[group]
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].First < ranges[j].First })
+		messages := make([]string, len(ranges))
+		for i, r := range ranges {
+			messages[i] = r.String()
+		}
+		fmt.Printf("  %s: %s\n", group, strings.Join(messages, ", "))
 	}
-	conf.Path = path
 }
 
 func inputReader() string {
@@ -158,3 +463,7 @@ func inputReader() string {
 	fmt.Printf("Error reading data: %v\n", reader.Err())
 	return ""
 }
+
+func logf(format string, v ...interface{}) {
+	fmt.Printf(format, v...)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Tensai75/nzbsearcher/searcher"
+)
+
+// nzbMeta returns the information written to the head of the NZB file for
+// hdr found in the groups of results.
+func nzbMeta(hdr *searcher.Header, results []searcher.GroupResult, completeness *searcher.Completeness) searcher.NZBMeta {
+	meta := searcher.NZBMeta{
+		Title:    conf.NZB.Title,
+		Category: conf.NZB.Category,
+		Password: conf.NZB.Password,
+	}
+	var servers []string
+	for _, result := range results {
+		meta.Partial = meta.Partial || result.Partial
+		if server := result.Server.String(); !containsString(servers, server) {
+			servers = append(servers, server)
+		}
+	}
+	if meta.Title == "" {
+		meta.Title = hdr.Name
+	}
+	meta.Completeness = completeness
+	if conf.NZB.Provenance {
+		meta.Query = hdr.Query
+		if meta.Query == "" {
+			meta.Query = strings.Join(headersToSearch, ", ")
+		}
+		for _, f := range hdr.FilesByHash {
+			meta.Groups = append(meta.Groups, f.Groups...)
+		}
+		meta.Server = strings.Join(servers, ",")
+		meta.From, meta.To = from, to
+	}
+	return meta
+}
+
+// saveNZB saves the NZB file for hdr found in group to the path given by
+// the filename templates.
+func saveNZB(hdr *searcher.Header, group string, meta searcher.NZBMeta) error {
+	filepath, err := nzbPath(newTemplateData(hdr, group, meta))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return err
+	}
+	f, filepath, err := createNZBFile(filepath)
+	if err != nil {
+		fmt.Printf("Error creating file '%s' to save NZB: %v\n", filepath, err)
+		return err
+	}
+	if f == nil {
+		fmt.Printf("Skipping existing NZB file '%s'\n", filepath)
+		return nil
+	}
+	defer f.Close()
+	if err := searcher.WriteNZB(f, hdr, meta); err != nil {
+		fmt.Printf("Error writing NZB to file '%s': %v\n", filepath, err)
+		return err
+	}
+	fmt.Printf("NZB file '%s' saved to disk\n", filepath)
+	return nil
+}
+
+// saveHeader saves the NZB file for hdr found in the groups of results,
+// unless it is not complete enough or, after verification, no file is left.
+func saveHeader(ctx context.Context, s *searcher.Searcher, hdr *searcher.Header, group string, results []searcher.GroupResult) {
+	if conf.Newsgroups {
+		if err := s.Newsgroups(ctx, hdr); err != nil {
+			fmt.Printf("Error retrieving the groups header '%s' was posted to: %v\n", hdr.Name, err)
+		}
+	}
+	if conf.Par2 {
+		hdr = applyPar2(ctx, s, hdr)
+	}
+	completeness := hdr.Completeness()
+	fmt.Printf("Header '%s': %s\n", hdr.Name, completeness)
+	for _, detail := range completeness.Details() {
+		fmt.Printf("  %s\n", detail)
+	}
+	if completeness.Percent() < conf.MinCompleteness {
+		fmt.Printf("Not saving NZB file, the header is less than %.1f%% complete\n", conf.MinCompleteness)
+		return
+	}
+	var availability []searcher.FileAvailability
+	if conf.Verify {
+		if hdr, availability = verifyHeader(ctx, s, hdr); hdr == nil {
+			return
+		}
+		if conf.DropUnavailable {
+			// the completeness written to the NZB file is that of the files
+			// left
+			completeness = hdr.Completeness()
+		}
+	}
+	meta := nzbMeta(hdr, results, &completeness)
+	meta.Availability = availability
+	if verbose {
+		fmt.Printf("Generating NZB file\n")
+	}
+	saveNZB(hdr, group, meta)
+}
+
+// applyPar2 renames the files of hdr to the names given in its PAR2 index
+// file and reports the files missing. hdr is returned unchanged if it has no
+// PAR2 index file or it cannot be read.
+func applyPar2(ctx context.Context, s *searcher.Searcher, hdr *searcher.Header) *searcher.Header {
+	renamed, report, err := s.ApplyPar2(ctx, hdr)
+	if err != nil {
+		if verbose {
+			fmt.Printf("Not using PAR2 file of header '%s': %v\n", hdr.Name, err)
+		}
+		return hdr
+	}
+	if verbose {
+		names := make([]string, 0, len(report.Renamed))
+		for name := range report.Renamed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("Renamed file '%s' to '%s' from PAR2 file\n", name, report.Renamed[name])
+		}
+	}
+	for _, f := range report.Missing {
+		fmt.Printf("File '%s' (%d bytes) of the PAR2 file is missing\n", f.Name, f.Size)
+	}
+	fmt.Printf("Header '%s': %d/%d files of the PAR2 file found, %d of %d bytes\n", hdr.Name, len(report.Files)-len(report.Missing), len(report.Files), report.FoundSize, report.ExpectedSize)
+	return renamed
+}
+
+// saveMergedHeaders merges the headers of posts cross-posted to several of
+// the groups searched and saves one NZB file per post.
+func saveMergedHeaders(ctx context.Context, s *searcher.Searcher, results []searcher.GroupResult) {
+	var headers []*searcher.Header
+	resultsByGroup := make(map[string]searcher.GroupResult, len(results))
+	for _, result := range results {
+		headers = append(headers, result.Headers...)
+		resultsByGroup[result.Group] = result
+	}
+	headers = searcher.MergeHeaders(headers)
+	if conf.YEncNames {
+		headers = s.RecoverFilenames(ctx, headers)
+	}
+	for _, hdr := range headers {
+		var (
+			groups       []string
+			groupResults []searcher.GroupResult
+		)
+		for _, f := range hdr.FilesByHash {
+			for _, group := range f.Groups {
+				if result, ok := resultsByGroup[group]; ok && !containsString(groups, group) {
+					groups = append(groups, group)
+					groupResults = append(groupResults, result)
+				}
+			}
+		}
+		sort.Strings(groups)
+		if len(groups) > 1 {
+			fmt.Printf("Header '%s' was found in %d groups: %s\n", hdr.Name, len(groups), strings.Join(groups, ", "))
+		}
+		saveHeader(ctx, s, hdr, groups[0], groupResults)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, value := range list {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
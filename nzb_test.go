@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tensai75/nzbsearcher/internal/nntptest"
+	"github.com/Tensai75/nzbsearcher/searcher"
+)
+
+// searchTestPost searches a server with a post of 2 files of 3 segments
+// each between random articles for headers and returns the store of the
+// server, the searcher and the result of the search.
+func searchTestPost(t *testing.T, headers ...string) (*nntptest.Store, *searcher.Searcher, searcher.GroupResult) {
+	const group = "alt.binaries.test"
+	start := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := nntptest.NewStore()
+	store.AddFiller(group, 1, 500, start, 10*time.Minute)
+	store.AddPost(group, nntptest.Post{
+		Header: "My.Show.S01E01.720p",
+		Files: []nntptest.PostFile{
+			{Name: "my.show.s01e01.part1.rar", Data: make([]byte, 2500)},
+			{Name: "my.show.s01e01.par2", Data: make([]byte, 2100)},
+		},
+		Date:     start.Add(500 * 10 * time.Minute),
+		Interval: time.Second,
+	})
+	store.AddFiller(group, 2, 500, start.Add(501*10*time.Minute), 10*time.Minute)
+	server, err := nntptest.NewServer(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	from, to = start.Add(3*24*time.Hour), start.Add(4*24*time.Hour)
+	s, err := searcher.New(searcher.Options{
+		Servers: []searcher.Server{{Host: server.Host(), Port: server.Port(), Connections: 2}},
+		Headers: headers,
+		From:    from,
+		To:      to,
+		Step:    100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	var results []searcher.GroupResult
+	s.SearchGroups(context.Background(), []string{group}, func(result searcher.GroupResult) {
+		results = append(results, result)
+	})
+	if len(results) != 1 || results[0].Err != nil || len(results[0].Headers) != len(headers) {
+		t.Fatalf("search returned %+v, want %d header(s)", results, len(headers))
+	}
+	return store, s, results[0]
+}
+
+func TestSaveNZB(t *testing.T) {
+	_, _, result := searchTestPost(t, "My.Show")
+	hdr := result.Headers[0]
+	conf.Path = t.TempDir()
+	conf.Filename = "{header}_{group}{partial}.nzb"
+	conf.Subdirectory = "{date:2006-01}"
+	conf.Overwrite = suffixFiles
+	conf.NZB = NZBConfiguration{Category: "TV", Provenance: true}
+	completeness := hdr.Completeness()
+	meta := nzbMeta(hdr, []searcher.GroupResult{result}, &completeness)
+
+	for i := 0; i < 2; i++ {
+		if err := saveNZB(hdr, result.Group, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path, err := nzbPath(newTemplateData(hdr, result.Group, meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(path)
+	if want := filepath.Join(conf.Path, "2022-03"); dir != want {
+		t.Errorf("NZB file saved to %s, want %s", dir, want)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".nzb")
+	for _, filename := range []string{name + ".nzb", name + "_2.nzb"} {
+		f, err := os.Open(filepath.Join(dir, filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved, err := searcher.ReadNZB(f, filename)
+		f.Close()
+		if err != nil {
+			t.Fatalf("error reading %s: %v", filename, err)
+		}
+		if len(saved.FilesByHash) != 2 {
+			t.Fatalf("%s has %d files, want 2", filename, len(saved.FilesByHash))
+		}
+		segments := 0
+		for _, file := range saved.FilesByHash {
+			segments += len(file.Messages)
+			if len(file.Groups) != 1 || file.Groups[0] != result.Group {
+				t.Errorf("file '%s' in %s lists groups %v, want %s", file.Name, filename, file.Groups, result.Group)
+			}
+		}
+		if segments != 6 {
+			t.Errorf("%s has %d segments, want 6", filename, segments)
+		}
+	}
+
+	conf.Overwrite = skipFiles
+	if err := saveNZB(hdr, result.Group, meta); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("found %d NZB files after skipping, want 2", len(entries))
+	}
+}
+
+func TestSaveNZBOverlappingQueries(t *testing.T) {
+	headersToSearch = headersFlag{"My.Show", "720p"}
+	t.Cleanup(func() { headersToSearch = nil })
+	_, _, result := searchTestPost(t, headersToSearch...)
+	conf.Path = t.TempDir()
+	conf.Filename = defaultFilename
+	conf.Subdirectory = ""
+	conf.Overwrite = overwriteFiles
+	conf.NZB = NZBConfiguration{Provenance: true}
+	for _, hdr := range result.Headers {
+		if hdr.Name != result.Headers[0].Name {
+			t.Fatalf("headers '%s' and '%s' found, want the same header for both queries", hdr.Name, result.Headers[0].Name)
+		}
+		completeness := hdr.Completeness()
+		if err := saveNZB(hdr, result.Group, nzbMeta(hdr, []searcher.GroupResult{result}, &completeness)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(conf.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("found %d NZB files, want 2", len(entries))
+	}
+	for _, hdr := range result.Headers {
+		path, err := nzbPath(newTemplateData(hdr, result.Group, searcher.NZBMeta{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("no NZB file for query '%s': %v", hdr.Query, err)
+		}
+	}
+}
+
+func TestNZBMetaCompleteness(t *testing.T) {
+	_, _, result := searchTestPost(t, "My.Show")
+	hdr := result.Headers[0]
+	conf.NZB = NZBConfiguration{}
+	completeness := hdr.Completeness()
+	meta := nzbMeta(hdr, []searcher.GroupResult{result}, &completeness)
+	if meta.Completeness == nil {
+		t.Error("no completeness report without provenance")
+	}
+	if meta.Query != "" || meta.Server != "" {
+		t.Errorf("provenance %q from %q written without provenance", meta.Query, meta.Server)
+	}
+}
+
+func TestSaveHeaderDropUnavailable(t *testing.T) {
+	store, s, result := searchTestPost(t, "My.Show")
+	hdr := result.Headers[0]
+	for _, f := range hdr.FilesByHash {
+		if f.Name == "my.show.s01e01.par2" {
+			store.Expire(f.Messages[0].MessageId)
+		}
+	}
+	conf.Path = t.TempDir()
+	conf.Filename = defaultFilename
+	conf.Subdirectory = ""
+	conf.Overwrite = overwriteFiles
+	conf.NZB = NZBConfiguration{}
+	conf.MinCompleteness = 0
+	conf.Verify, conf.DropUnavailable = true, true
+	t.Cleanup(func() { conf.Verify, conf.DropUnavailable = false, false })
+	saveHeader(context.Background(), s, hdr, result.Group, []searcher.GroupResult{result})
+
+	entries, err := os.ReadDir(conf.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("found %d NZB files, want 1", len(entries))
+	}
+	data, err := os.ReadFile(filepath.Join(conf.Path, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nzb := string(data)
+	if strings.Contains(nzb, "my.show.s01e01.par2") {
+		t.Error("unavailable file written to the NZB file")
+	}
+	for _, want := range []string{
+		`<meta type="completeness">1/2 files, 3/3 segments (50.0%)</meta>`,
+		`<meta type="incomplete">missing files: 2</meta>`,
+	} {
+		if !strings.Contains(nzb, want) {
+			t.Errorf("NZB file does not contain %s:\n%s", want, nzb)
+		}
+	}
+}
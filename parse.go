@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Tensai75/nzbsearcher/searcher"
+)
+
+// exit codes of the parse command
+const (
+	parseParsed   = 0
+	parseUnparsed = 1
+	parseError    = 2
+)
+
+// parseSubjects parses the subjects given or, if none is given or the only
+// one is "-", the subjects read line by line from stdin and prints what was
+// extracted from every subject. It returns the exit code: 0 if all subjects
+// were parsed, 1 if subjects were not understood and 2 on errors.
+func parseSubjects(subjects []string) int {
+	parser, err := subjectParser()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return parseError
+	}
+	group := strings.Replace(strings.TrimSpace(parseGroup), "a.b.", "alt.binaries.", 1)
+	code := parseParsed
+	parse := func(subject string) {
+		if !printParsedSubject(parser, subject, group) {
+			code = parseUnparsed
+		}
+	}
+	if len(subjects) > 0 && !(len(subjects) == 1 && subjects[0] == "-") {
+		for _, subject := range subjects {
+			parse(subject)
+		}
+		return code
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if subject := strings.TrimRight(scanner.Text(), "\r"); subject != "" {
+			parse(subject)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Printf("Error reading subjects: %v\n", err)
+		return parseError
+	}
+	return code
+}
+
+// printParsedSubject prints what parser extracted from subject and returns
+// whether the subject was understood.
+func printParsedSubject(parser searcher.SubjectParser, subject string, group string) bool {
+	fmt.Printf("Subject:  %s\n", subject)
+	parsed, err := parser.ParseSubject(subject, group)
+	if err != nil {
+		fmt.Printf("Error:    %v\n\n", err)
+		return false
+	}
+	fmt.Printf("Rule:     %s\n", parsed.Rule)
+	fmt.Printf("Header:   %s\n", parsed.Header)
+	fmt.Printf("Filename: %s\n", parsed.Filename)
+	fmt.Printf("Basename: %s\n", parsed.Basefilename)
+	fmt.Printf("File:     %d/%d\n", parsed.FileNo, parsed.TotalFiles)
+	fmt.Printf("Segment:  %d/%d\n\n", parsed.SegmentNo, parsed.TotalSegments)
+	return true
+}
@@ -0,0 +1,279 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// default interval between two checkpoints if not set in the options
+const defaultCheckpointInterval = time.Minute
+
+// State is the state of a search, saved periodically to the state file so an
+// interrupted search can be resumed.
+type State struct {
+	Headers []string
+	From    time.Time
+	To      time.Time
+	Groups  []string
+	// GroupStates holds the state of every group the search was started in.
+	GroupStates map[string]*GroupState
+}
+
+// GroupState is the state of the search in one group.
+type GroupState struct {
+	// Server is the server the group is searched on. Article numbers are
+	// specific to a server, so a search can only be resumed on the same
+	// server.
+	Server string
+	// First and Last are the first and last message of the search range,
+	// FirstDate and LastDate their dates.
+	First     int
+	Last      int
+	FirstDate time.Time
+	LastDate  time.Time
+	// Completed are the article ranges already searched.
+	Completed []Range
+	// Finished is true if the search in the group has finished.
+	Finished bool
+	// Headers are the headers found so far.
+	Headers map[string]*Header
+}
+
+// LoadState reads the state of a search from the state file at path.
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid state file '%s': %w", path, err)
+	}
+	if state.GroupStates == nil {
+		state.GroupStates = make(map[string]*GroupState)
+	}
+	return &state, nil
+}
+
+// Save writes the state atomically to the state file at path.
+func (state *State) Save(path string) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// resume restores the headers found and the ranges searched from the state
+// of an earlier search.
+func (s *Searcher) resume(state *State) error {
+	if !equalStrings(state.Headers, s.opts.Headers) || !state.From.Equal(s.opts.From) || !state.To.Equal(s.opts.To) {
+		return errors.New("the state file belongs to a search with other parameters")
+	}
+	for group, groupState := range state.GroupStates {
+		headers := make(map[string]*Header, len(groupState.Headers))
+		for hash, hdr := range groupState.Headers {
+			headers[hash] = hdr
+		}
+		s.headersByGroupAndHeaderHash[group] = headers
+		s.groupStates[group] = &GroupState{
+			Server:    groupState.Server,
+			First:     groupState.First,
+			Last:      groupState.Last,
+			FirstDate: groupState.FirstDate,
+			LastDate:  groupState.LastDate,
+			Completed: append([]Range(nil), groupState.Completed...),
+			Finished:  groupState.Finished,
+		}
+	}
+	return nil
+}
+
+// State returns a snapshot of the current state of the search.
+func (s *Searcher) State(groups []string) *State {
+	// wait for the batches being processed to have a consistent snapshot
+	s.batchMutex.Lock()
+	defer s.batchMutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state := &State{
+		Headers:     s.opts.Headers,
+		From:        s.opts.From,
+		To:          s.opts.To,
+		Groups:      groups,
+		GroupStates: make(map[string]*GroupState, len(s.groupStates)),
+	}
+	for group, groupState := range s.groupStates {
+		headers := make(map[string]*Header, len(s.headersByGroupAndHeaderHash[group]))
+		for hash, hdr := range s.headersByGroupAndHeaderHash[group] {
+			files := make(map[string]*File, len(hdr.FilesByHash))
+			for fileHash, f := range hdr.FilesByHash {
+				fileCopy := *f
+				fileCopy.Messages = append([]Message(nil), f.Messages...)
+				files[fileHash] = &fileCopy
+			}
+			headers[hash] = &Header{Name: hdr.Name, Hash: hdr.Hash, Query: hdr.Query, FilesByHash: files}
+		}
+		state.GroupStates[group] = &GroupState{
+			Server:    groupState.Server,
+			First:     groupState.First,
+			Last:      groupState.Last,
+			FirstDate: groupState.FirstDate,
+			LastDate:  groupState.LastDate,
+			Completed: append([]Range(nil), groupState.Completed...),
+			Finished:  groupState.Finished,
+			Headers:   headers,
+		}
+	}
+	return state
+}
+
+// checkpoint saves the state of the search to the state file every
+// checkpoint interval until ctx is done.
+func (s *Searcher) checkpoint(ctx context.Context, groups []string) {
+	ticker := time.NewTicker(s.opts.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.saveState(groups)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Searcher) saveState(groups []string) {
+	if err := s.State(groups).Save(s.opts.StateFile); err != nil {
+		s.logf("Error saving the search state to '%s': %v\n", s.opts.StateFile, err)
+		return
+	}
+	s.debugf("Search state saved to '%s'\n", s.opts.StateFile)
+}
+
+// resumeRange returns the search range of group saved in the state of an
+// earlier search, the ranges already searched and whether the search in the
+// group has already finished. It returns a nil range if the search in group
+// has not been started yet.
+func (s *Searcher) resumeRange(group string) (*searchRange, []Range, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	groupState, ok := s.groupStates[group]
+	if !ok {
+		return nil, nil, false, nil
+	}
+	for _, p := range s.pools {
+		if p.server.String() == groupState.Server {
+			r := &searchRange{
+				pool:           p,
+				firstMessageID: groupState.First,
+				firstDate:      groupState.FirstDate,
+				lastMessageID:  groupState.Last,
+				lastDate:       groupState.LastDate,
+				complete:       true,
+			}
+			return r, append([]Range(nil), groupState.Completed...), groupState.Finished, nil
+		}
+	}
+	return nil, nil, false, fmt.Errorf("server %s of the saved search state is not configured", groupState.Server)
+}
+
+func (s *Searcher) startGroupState(group string, r *searchRange) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.groupStates[group] = &GroupState{
+		Server:    r.pool.server.String(),
+		First:     r.firstMessageID,
+		Last:      r.lastMessageID,
+		FirstDate: r.firstDate,
+		LastDate:  r.lastDate,
+	}
+}
+
+func (s *Searcher) finishGroupState(group string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if groupState, ok := s.groupStates[group]; ok {
+		groupState.Finished = true
+	}
+}
+
+// addCompletedRange marks the range r in group as searched. The caller
+// must hold s.mutex.
+func (s *Searcher) addCompletedRange(group string, r Range) {
+	groupState, ok := s.groupStates[group]
+	if !ok {
+		return
+	}
+	groupState.Completed = mergeRanges(append(groupState.Completed, r))
+}
+
+// mergeRanges sorts ranges and merges overlapping and adjacent ranges.
+func mergeRanges(ranges []Range) []Range {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].First < ranges[j].First })
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.First <= merged[n-1].Last+1 {
+			if r.Last > merged[n-1].Last {
+				merged[n-1].Last = r.Last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// missingRanges returns the parts of r not covered by the sorted and merged
+// ranges completed.
+func missingRanges(r Range, completed []Range) []Range {
+	var missing []Range
+	next := r.First
+	for _, c := range completed {
+		if c.Last < next {
+			continue
+		}
+		if c.First > r.Last {
+			break
+		}
+		if c.First > next {
+			missing = append(missing, Range{First: next, Last: c.First - 1})
+		}
+		next = c.Last + 1
+	}
+	if next <= r.Last {
+		missing = append(missing, Range{First: next, Last: r.Last})
+	}
+	return missing
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package searcher
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Tensai75/nzbsearcher/internal/nntptest"
+)
+
+func TestMergeRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []Range
+		want   []Range
+	}{
+		{name: "empty"},
+		{name: "single", ranges: []Range{{5, 10}}, want: []Range{{5, 10}}},
+		{name: "unsorted", ranges: []Range{{20, 30}, {1, 5}}, want: []Range{{1, 5}, {20, 30}}},
+		{name: "overlapping", ranges: []Range{{1, 10}, {5, 15}}, want: []Range{{1, 15}}},
+		{name: "adjacent", ranges: []Range{{11, 20}, {1, 10}}, want: []Range{{1, 20}}},
+		{name: "contained", ranges: []Range{{1, 20}, {5, 10}}, want: []Range{{1, 20}}},
+		{name: "gap of one", ranges: []Range{{1, 10}, {12, 20}}, want: []Range{{1, 10}, {12, 20}}},
+		{name: "chain", ranges: []Range{{7, 9}, {1, 3}, {4, 6}, {30, 40}, {10, 10}}, want: []Range{{1, 10}, {30, 40}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mergeRanges(test.ranges); !(len(got) == 0 && len(test.want) == 0) && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMissingRanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		r         Range
+		completed []Range
+		want      []Range
+	}{
+		{name: "nothing completed", r: Range{1, 100}, want: []Range{{1, 100}}},
+		{name: "all completed", r: Range{10, 20}, completed: []Range{{1, 100}}},
+		{name: "exactly completed", r: Range{10, 20}, completed: []Range{{10, 20}}},
+		{name: "start completed", r: Range{1, 100}, completed: []Range{{1, 50}}, want: []Range{{51, 100}}},
+		{name: "end completed", r: Range{1, 100}, completed: []Range{{50, 200}}, want: []Range{{1, 49}}},
+		{name: "holes", r: Range{1, 100}, completed: []Range{{10, 20}, {21, 30}, {50, 60}}, want: []Range{{1, 9}, {31, 49}, {61, 100}}},
+		{name: "outside", r: Range{40, 50}, completed: []Range{{1, 10}, {60, 70}}, want: []Range{{40, 50}}},
+		{name: "single message", r: Range{5, 5}, completed: []Range{{1, 4}, {6, 9}}, want: []Range{{5, 5}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := missingRanges(test.r, test.completed); !(len(got) == 0 && len(test.want) == 0) && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResume(t *testing.T) {
+	store, post := newTestStore()
+	s, server := newTestSearcher(t, store, "My.Show")
+	opts := s.opts
+	// small steps, so the post is spread over several batches
+	opts.Step = 3
+	ctx := context.Background()
+
+	complete, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer complete.Close()
+	want, err := complete.Search(ctx, testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPost(t, want)
+
+	// interrupt the search by a failure in the middle of the post
+	interrupted, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer interrupted.Close()
+	failed := postBatch(t, interrupted, post[4])
+	server.Inject(nntptest.Fault{Command: "OVER", Args: failed.String(), Code: 502, Message: "permission denied"})
+	if _, err := interrupted.Search(ctx, testGroup); err != nil {
+		t.Fatal(err)
+	}
+	server.ClearFaults()
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := interrupted.State([]string{testGroup}).Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Resume = state
+	resumed, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	commands := server.CountCommands("OVER")
+	got, err := resumed.Search(ctx, testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the failed batch is searched again
+	if n := server.CountCommands("OVER") - commands; n != 1 {
+		t.Errorf("resumed search sent %d OVER commands, want 1", n)
+	}
+	checkPost(t, got)
+	var wantNZB, gotNZB bytes.Buffer
+	if err := WriteNZB(&wantNZB, want[0], NZBMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteNZB(&gotNZB, got[0], NZBMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotNZB.Bytes(), wantNZB.Bytes()) {
+		t.Errorf("NZB of resumed search differs:\n%s\nwant\n%s", gotNZB.Bytes(), wantNZB.Bytes())
+	}
+
+	opts.Headers = []string{"Other"}
+	if _, err := New(opts); err == nil {
+		t.Error("resumed search with other headers")
+	}
+}
@@ -0,0 +1,139 @@
+package searcher
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Completeness is the completeness report of a header, based on the number
+// of files and segments given in the subjects of its messages.
+type Completeness struct {
+	// Files is the number of files found, TotalFiles the number of files
+	// of the post.
+	Files      int
+	TotalFiles int
+	// Segments is the number of distinct segments found, TotalSegments the
+	// number of segments of the files found.
+	Segments      int
+	TotalSegments int
+	// MissingFiles are the numbers of the files not found.
+	MissingFiles []int
+	// MissingSegments and DuplicateSegments are the numbers of the segments
+	// not found and found more than once, keyed by file name.
+	MissingSegments   map[string][]int
+	DuplicateSegments map[string][]int
+}
+
+// Completeness returns the completeness report of hdr.
+func (hdr *Header) Completeness() Completeness {
+	c := Completeness{
+		MissingSegments:   make(map[string][]int),
+		DuplicateSegments: make(map[string][]int),
+	}
+	fileNumbers := make(map[int]bool)
+	for _, f := range hdr.FilesByHash {
+		c.Files++
+		fileNumbers[f.Number] = true
+		totalSegments := 0
+		found := make(map[int]int)
+		for _, msg := range f.Messages {
+			if msg.TotalFiles > c.TotalFiles {
+				c.TotalFiles = msg.TotalFiles
+			}
+			if msg.TotalSegments > totalSegments {
+				totalSegments = msg.TotalSegments
+			}
+			found[msg.SegmentNo]++
+		}
+		c.TotalSegments += totalSegments
+		for segment := 1; segment <= totalSegments; segment++ {
+			if found[segment] == 0 {
+				c.MissingSegments[f.Name] = append(c.MissingSegments[f.Name], segment)
+			}
+		}
+		for segment, count := range found {
+			if segment >= 1 && segment <= totalSegments {
+				c.Segments++
+			}
+			if count > 1 {
+				c.DuplicateSegments[f.Name] = append(c.DuplicateSegments[f.Name], segment)
+			}
+		}
+		sort.Ints(c.DuplicateSegments[f.Name])
+	}
+	if c.TotalFiles < c.Files {
+		c.TotalFiles = c.Files
+	}
+	for number := 1; number <= c.TotalFiles; number++ {
+		if !fileNumbers[number] {
+			c.MissingFiles = append(c.MissingFiles, number)
+		}
+	}
+	for name, segments := range c.DuplicateSegments {
+		if len(segments) == 0 {
+			delete(c.DuplicateSegments, name)
+		}
+	}
+	return c
+}
+
+// Percent returns the estimated share of the post found in percent. The
+// files not found are assumed to have the average number of segments of the
+// files found.
+func (c Completeness) Percent() float64 {
+	if c.TotalSegments == 0 {
+		return 0
+	}
+	total := float64(c.TotalSegments)
+	if c.Files > 0 {
+		total += float64(len(c.MissingFiles)) * float64(c.TotalSegments) / float64(c.Files)
+	}
+	return float64(c.Segments) / total * 100
+}
+
+// Complete reports whether all files and segments of the post were found.
+func (c Completeness) Complete() bool {
+	return len(c.MissingFiles) == 0 && c.Segments == c.TotalSegments
+}
+
+func (c Completeness) String() string {
+	return fmt.Sprintf("%d/%d files, %d/%d segments (%.1f%%)", c.Files, c.TotalFiles, c.Segments, c.TotalSegments, c.Percent())
+}
+
+// numberRanges returns the sorted numbers as ranges of consecutive numbers.
+func numberRanges(numbers []int) []Range {
+	var ranges []Range
+	for _, number := range numbers {
+		if len(ranges) > 0 && ranges[len(ranges)-1].Last == number-1 {
+			ranges[len(ranges)-1].Last = number
+			continue
+		}
+		ranges = append(ranges, Range{First: number, Last: number})
+	}
+	return ranges
+}
+
+// Details returns a line for every missing file and every file with
+// missing or duplicate segments.
+func (c Completeness) Details() []string {
+	var details []string
+	if len(c.MissingFiles) > 0 {
+		details = append(details, fmt.Sprintf("missing files: %s", formatRanges(numberRanges(c.MissingFiles))))
+	}
+	for _, name := range sortedKeys(c.MissingSegments) {
+		details = append(details, fmt.Sprintf("%s: missing segments: %s", name, formatRanges(numberRanges(c.MissingSegments[name]))))
+	}
+	for _, name := range sortedKeys(c.DuplicateSegments) {
+		details = append(details, fmt.Sprintf("%s: duplicate segments: %s", name, formatRanges(numberRanges(c.DuplicateSegments[name]))))
+	}
+	return details
+}
+
+func sortedKeys(m map[string][]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,144 @@
+package searcher
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maximum number of samples kept per group
+const maxDateSamples = 512
+
+// DateSample is the date of a message in a group.
+type DateSample struct {
+	Number int
+	Date   int64
+}
+
+// DateCache holds the dates of messages found while scanning the groups for
+// the messages to start and end the search, so later searches can start
+// scanning close to these messages.
+//
+// The samples are stored per server and group, as the article numbers are
+// specific to a server.
+type DateCache struct {
+	path string
+
+	mutex   sync.Mutex
+	Servers map[string]map[string][]DateSample
+}
+
+// LoadDateCache loads the date cache from the file at path. An empty cache
+// is returned if the file does not exist.
+func LoadDateCache(path string) (*DateCache, error) {
+	cache := &DateCache{path: path, Servers: make(map[string]map[string][]DateSample)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, err
+	}
+	if cache.Servers == nil {
+		cache.Servers = make(map[string]map[string][]DateSample)
+	}
+	return cache, nil
+}
+
+// Save writes the date cache to the file it was loaded from.
+func (cache *DateCache) Save() error {
+	cache.mutex.Lock()
+	data, err := json.Marshal(cache)
+	cache.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cache.path, data, 0644)
+}
+
+// Add adds the date of message number of group on server to the cache.
+func (cache *DateCache) Add(server string, group string, number int, date time.Time) {
+	if date.IsZero() {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	groups, ok := cache.Servers[server]
+	if !ok {
+		groups = make(map[string][]DateSample)
+		cache.Servers[server] = groups
+	}
+	samples := groups[group]
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Number >= number })
+	if i < len(samples) && samples[i].Number == number {
+		samples[i].Date = date.Unix()
+		return
+	}
+	samples = append(samples, DateSample{})
+	copy(samples[i+1:], samples[i:])
+	samples[i] = DateSample{Number: number, Date: date.Unix()}
+	if len(samples) > maxDateSamples {
+		// thin out the samples, keeping the first and the last one
+		thinned := samples[:0]
+		for i, sample := range samples {
+			if i%2 == 0 || i == len(samples)-1 {
+				thinned = append(thinned, sample)
+			}
+		}
+		samples = thinned
+	}
+	groups[group] = samples
+}
+
+// Samples returns the samples of group on server within the messages first
+// to last, sorted by message number.
+func (cache *DateCache) Samples(server string, group string, first int, last int) []DateSample {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	var samples []DateSample
+	for _, sample := range cache.Servers[server][group] {
+		if sample.Number >= first && sample.Number <= last {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// addDateSample adds the date of a message of the group selected on c to the
+// date cache, if one is used.
+func (s *Searcher) addDateSample(c *conn, number int, date time.Time) {
+	if s.opts.DateCache != nil {
+		s.opts.DateCache.Add(c.server, c.group, number, date)
+	}
+}
+
+// cachedRange returns the two cached messages within firstMessageID and
+// lastMessageID closest to each other with the first message newer than
+// endTimestamp between them. ok is false if there are no such messages in
+// the cache. The dates in the cache may be outdated and must be verified.
+func (s *Searcher) cachedRange(c *conn, firstMessageID int, lastMessageID int, endTimestamp int64) (int, int, bool) {
+	if s.opts.DateCache == nil {
+		return 0, 0, false
+	}
+	samples := s.opts.DateCache.Samples(c.server, c.group, firstMessageID, lastMessageID)
+	lo, hi := -1, -1
+	for i, sample := range samples {
+		if sample.Date <= endTimestamp {
+			lo = i
+		} else if lo >= 0 {
+			hi = i
+			break
+		}
+	}
+	if lo < 0 || hi < 0 {
+		return 0, 0, false
+	}
+	s.debugf("Using cached dates for group '%s' to scan messages %d to %d\n", c.group, samples[lo].Number, samples[hi].Number)
+	return samples[lo].Number, samples[hi].Number, true
+}
@@ -0,0 +1,135 @@
+package searcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Filter restricts the headers returned by a search. The zero value lets
+// all headers pass.
+type Filter struct {
+	// Posters are the patterns of which the poster of a header must match
+	// at least one, ExcludePosters those of which it must match none. The
+	// patterns are matched case insensitively against the whole poster,
+	// "*" matches any number of characters and "?" one character.
+	Posters        []string
+	ExcludePosters []string
+	// MinBytes and MaxBytes limit the total size of all messages of a
+	// header. No limit is applied if 0.
+	MinBytes int64
+	MaxBytes int64
+	// MinFiles is the minimum number of files of a header.
+	MinFiles int
+	// Extensions are the file extensions of which a header must contain at
+	// least one file each, e.g. ".par2".
+	Extensions []string
+	// PostedFrom and PostedTo limit the date the first message of a header
+	// was posted on. PostedTo is exclusive. No limit is applied if zero.
+	PostedFrom time.Time
+	PostedTo   time.Time
+}
+
+// compiledFilter is a Filter with the poster patterns compiled.
+type compiledFilter struct {
+	Filter
+	posters        []*regexp.Regexp
+	excludePosters []*regexp.Regexp
+}
+
+func compileFilter(filter Filter) *compiledFilter {
+	f := &compiledFilter{Filter: filter}
+	for _, poster := range filter.Posters {
+		f.posters = append(f.posters, posterPattern(poster))
+	}
+	for _, poster := range filter.ExcludePosters {
+		f.excludePosters = append(f.excludePosters, posterPattern(poster))
+	}
+	return f
+}
+
+func posterPattern(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^" + wildcardPattern(strings.TrimSpace(pattern)).String() + "$")
+}
+
+// reject returns the reason why hdr does not pass the filter or an empty
+// string if it passes.
+func (f *compiledFilter) reject(hdr *Header) string {
+	var (
+		poster string
+		bytes  int64
+		posted int64
+	)
+	for _, file := range hdr.FilesByHash {
+		poster = file.Poster
+		for _, msg := range file.Messages {
+			bytes += int64(msg.Bytes)
+			if msg.Date > 0 && (posted == 0 || msg.Date < posted) {
+				posted = msg.Date
+			}
+		}
+	}
+	if len(f.posters) > 0 && !matchesAny(f.posters, poster) {
+		return fmt.Sprintf("poster '%s' is not included", poster)
+	}
+	if matchesAny(f.excludePosters, poster) {
+		return fmt.Sprintf("poster '%s' is excluded", poster)
+	}
+	if f.MinBytes > 0 && bytes < f.MinBytes {
+		return fmt.Sprintf("size of %d bytes is below the minimum", bytes)
+	}
+	if f.MaxBytes > 0 && bytes > f.MaxBytes {
+		return fmt.Sprintf("size of %d bytes is above the maximum", bytes)
+	}
+	if len(hdr.FilesByHash) < f.MinFiles {
+		return fmt.Sprintf("%d file(s) are less than the minimum", len(hdr.FilesByHash))
+	}
+	for _, extension := range f.Extensions {
+		if !hasExtension(hdr, extension) {
+			return fmt.Sprintf("no %s file", extension)
+		}
+	}
+	if !f.PostedFrom.IsZero() && posted < f.PostedFrom.Unix() {
+		return fmt.Sprintf("posted before %s", f.PostedFrom)
+	}
+	if !f.PostedTo.IsZero() && posted >= f.PostedTo.Unix() {
+		return fmt.Sprintf("posted at or after %s", f.PostedTo)
+	}
+	return ""
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExtension(hdr *Header, extension string) bool {
+	extension = strings.ToLower(strings.TrimSpace(extension))
+	if !strings.HasPrefix(extension, ".") {
+		extension = "." + extension
+	}
+	for _, file := range hdr.FilesByHash {
+		if strings.HasSuffix(strings.ToLower(file.Name), extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// results returns the headers found so far in group passing the filter.
+func (s *Searcher) results(group string) []*Header {
+	var headers []*Header
+	for _, hdr := range s.Results()[group] {
+		if reason := s.filter.reject(hdr); reason != "" {
+			s.debugf("Header '%s' in group '%s' was filtered out: %s\n", hdr.Name, group, reason)
+			continue
+		}
+		headers = append(headers, hdr)
+	}
+	return headers
+}
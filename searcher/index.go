@@ -0,0 +1,294 @@
+package searcher
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tensai75/nntp"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	overviewsBucket = []byte("overviews")
+	rangesBucket    = []byte("ranges")
+)
+
+// Index is a local database of message overviews retrieved from the
+// usenet servers. Message overviews already in the index are not
+// retrieved from the server again.
+//
+// The overviews are stored per server and group, as the article numbers are
+// specific to a server.
+type Index struct {
+	db *bolt.DB
+}
+
+// OpenIndex opens the index database at path, creating it if it does not
+// exist.
+func OpenIndex(path string) (*Index, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Index{db: db}, nil
+}
+
+// Close closes the index database.
+func (index *Index) Close() error {
+	return index.db.Close()
+}
+
+// Ranges returns the sorted article ranges of group on server in the index.
+func (index *Index) Ranges(server string, group string) ([]Range, error) {
+	var ranges []Range
+	err := index.db.View(func(tx *bolt.Tx) error {
+		b := groupBucket(tx, server, group)
+		if b == nil {
+			return nil
+		}
+		return b.Bucket(rangesBucket).ForEach(func(k, v []byte) error {
+			ranges = append(ranges, Range{First: decodeNumber(k), Last: decodeNumber(v)})
+			return nil
+		})
+	})
+	return ranges, err
+}
+
+// Overviews returns the overviews of the messages first to last of group on
+// server in the index.
+func (index *Index) Overviews(server string, group string, first int, last int) ([]nntp.MessageOverview, error) {
+	var overviews []nntp.MessageOverview
+	err := index.forEach(server, group, first, last, func(overview nntp.MessageOverview) bool {
+		overviews = append(overviews, overview)
+		return true
+	})
+	return overviews, err
+}
+
+// forEach calls fn with the overviews of the messages first to last of
+// group on server in the index, in the order of their numbers, until fn
+// returns false.
+func (index *Index) forEach(server string, group string, first int, last int, fn func(nntp.MessageOverview) bool) error {
+	return index.db.View(func(tx *bolt.Tx) error {
+		b := groupBucket(tx, server, group)
+		if b == nil {
+			return nil
+		}
+		c := b.Bucket(overviewsBucket).Cursor()
+		for k, v := c.Seek(encodeNumber(first)); k != nil && decodeNumber(k) <= last; k, v = c.Next() {
+			if !fn(decodeOverview(decodeNumber(k), v)) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// Add adds the overviews of the messages in r of group on server to the
+// index and marks r as indexed.
+func (index *Index) Add(server string, group string, r Range, overviews []nntp.MessageOverview) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		serverBucket, err := tx.CreateBucketIfNotExists([]byte(server))
+		if err != nil {
+			return err
+		}
+		b, err := serverBucket.CreateBucketIfNotExists([]byte(group))
+		if err != nil {
+			return err
+		}
+		overviewBucket, err := b.CreateBucketIfNotExists(overviewsBucket)
+		if err != nil {
+			return err
+		}
+		for _, overview := range overviews {
+			if err := overviewBucket.Put(encodeNumber(overview.MessageNumber), encodeOverview(overview)); err != nil {
+				return err
+			}
+		}
+		rangeBucket, err := b.CreateBucketIfNotExists(rangesBucket)
+		if err != nil {
+			return err
+		}
+		var ranges []Range
+		if err := rangeBucket.ForEach(func(k, v []byte) error {
+			ranges = append(ranges, Range{First: decodeNumber(k), Last: decodeNumber(v)})
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, r := range ranges {
+			if err := rangeBucket.Delete(encodeNumber(r.First)); err != nil {
+				return err
+			}
+		}
+		for _, r := range mergeRanges(append(ranges, r)) {
+			if err := rangeBucket.Put(encodeNumber(r.First), encodeNumber(r.Last)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func groupBucket(tx *bolt.Tx, server string, group string) *bolt.Bucket {
+	serverBucket := tx.Bucket([]byte(server))
+	if serverBucket == nil {
+		return nil
+	}
+	return serverBucket.Bucket([]byte(group))
+}
+
+// article numbers are stored big endian so the keys are sorted by number
+func encodeNumber(number int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(number))
+	return key
+}
+
+func decodeNumber(key []byte) int {
+	return int(binary.BigEndian.Uint64(key))
+}
+
+// the overviews are stored with their fields separated by tabs, just like
+// in the response to the OVER command
+func encodeOverview(overview nntp.MessageOverview) []byte {
+	fields := append([]string{
+		overview.Subject,
+		overview.From,
+		strconv.FormatInt(overview.Date.Unix(), 10),
+		overview.MessageId,
+		strings.Join(overview.References, " "),
+		strconv.Itoa(overview.Bytes),
+		strconv.Itoa(overview.Lines),
+	}, overview.Extra...)
+	return []byte(strings.Join(fields, "\t"))
+}
+
+func decodeOverview(number int, value []byte) nntp.MessageOverview {
+	fields := strings.SplitN(string(value), "\t", 8)
+	for len(fields) < 7 {
+		fields = append(fields, "")
+	}
+	overview := nntp.MessageOverview{
+		MessageNumber: number,
+		Subject:       fields[0],
+		From:          fields[1],
+		MessageId:     fields[3],
+		References:    strings.Split(fields[4], " "),
+	}
+	if date, err := strconv.ParseInt(fields[2], 10, 64); err == nil && date > 0 {
+		overview.Date = time.Unix(date, 0).UTC()
+	}
+	overview.Bytes, _ = strconv.Atoi(fields[5])
+	overview.Lines, _ = strconv.Atoi(fields[6])
+	if len(fields) == 8 {
+		overview.Extra = strings.Split(fields[7], "\t")
+	}
+	return overview
+}
+
+// overview returns the overviews of the messages first to last of the group
+// selected on c. If an index is used, only the messages not in the index
+// are retrieved from the server.
+func (s *Searcher) overview(c *conn, first int, last int) ([]nntp.MessageOverview, error) {
+	if s.opts.Index == nil {
+		return c.Overview(first, last)
+	}
+	// only index the range of messages currently in the group
+	if first < c.firstMessageID {
+		first = c.firstMessageID
+	}
+	if last > c.lastMessageID {
+		last = c.lastMessageID
+	}
+	if first > last {
+		return nil, nil
+	}
+	indexed, err := s.opts.Index.Ranges(c.server, c.group)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range missingRanges(Range{First: first, Last: last}, indexed) {
+		overviews, err := c.Overview(r.First, r.Last)
+		if err != nil && !isNoArticles(err) {
+			return nil, err
+		}
+		if err := s.opts.Index.Add(c.server, c.group, r, overviews); err != nil {
+			return nil, err
+		}
+	}
+	return s.opts.Index.Overviews(c.server, c.group, first, last)
+}
+
+// indexedOverviews returns the overviews of the messages first to last of
+// group on the server of p from the index. ok is false if not all of these
+// messages are in the index.
+func (s *Searcher) indexedOverviews(p *pool, group string, first int, last int) (overviews []nntp.MessageOverview, ok bool, err error) {
+	if s.opts.Index == nil {
+		return nil, false, nil
+	}
+	server := p.server.String()
+	indexed, err := s.opts.Index.Ranges(server, group)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(missingRanges(Range{First: first, Last: last}, indexed)) > 0 {
+		return nil, false, nil
+	}
+	overviews, err = s.opts.Index.Overviews(server, group, first, last)
+	return overviews, err == nil, err
+}
+
+// indexedRange returns the search range of group on the server of p from
+// the index, or nil if no range of messages in the index reaches from a
+// message posted before the start of the date range searched to one posted
+// after its end. Then the group can be searched without a connection to the
+// server.
+func (s *Searcher) indexedRange(p *pool, group string) (*searchRange, error) {
+	if s.opts.Index == nil {
+		return nil, nil
+	}
+	server := p.server.String()
+	indexed, err := s.opts.Index.Ranges(server, group)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range indexed {
+		var (
+			before bool
+			start  *nntp.MessageOverview
+			result *searchRange
+		)
+		err := s.opts.Index.forEach(server, group, r.First, r.Last, func(overview nntp.MessageOverview) bool {
+			if start == nil {
+				if overview.Date.Before(s.opts.From) {
+					before = true
+					return true
+				}
+				if !before {
+					// the range starts within the date range searched
+					return false
+				}
+				start = &overview
+			}
+			if !overview.Date.Before(s.opts.To) {
+				result = &searchRange{
+					pool:           p,
+					firstMessageID: start.MessageNumber,
+					firstDate:      start.Date,
+					lastMessageID:  overview.MessageNumber,
+					lastDate:       overview.Date,
+					complete:       true,
+				}
+				return false
+			}
+			return true
+		})
+		if err != nil || result != nil {
+			return result, err
+		}
+	}
+	return nil, nil
+}
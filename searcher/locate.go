@@ -0,0 +1,232 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Tensai75/nntp"
+)
+
+const (
+	// default maximum distance between the two messages bracketing the
+	// searched date before the messages in between are scanned one by one
+	defaultScanTolerance = 1000
+	// number of messages retrieved with each probe, the median of their
+	// dates is taken as the date at the position of the probe
+	probeSize = 32
+	// maximum number of probes before giving up
+	maxProbes = 100
+)
+
+// Boundary is a message found by scanning a group for a date.
+type Boundary struct {
+	Number int
+	Date   time.Time
+	// Probes is the number of overview requests needed to find the message.
+	Probes int
+}
+
+// probe is the date at a position in a group.
+type probe struct {
+	number int
+	date   int64
+}
+
+// ScanForDate returns the first message in group newer than date.
+// If first is true, the first message of the group is returned if it is
+// newer than date. Otherwise an error is returned in this case.
+func (s *Searcher) ScanForDate(ctx context.Context, group string, date time.Time, first bool) (Boundary, error) {
+	var boundary Boundary
+	err := s.groupPool(group).request(ctx, group, func(conn *conn) (err error) {
+		boundary, err = s.scanForDate(conn, conn.firstMessageID, conn.lastMessageID, date, first)
+		return err
+	})
+	return boundary, err
+}
+
+// scanForDate locates the first message between firstMessageID and
+// lastMessageID posted after date.
+//
+// The messages bracketing the date are narrowed down by probing the
+// position interpolated from the dates of the bracketing messages, falling
+// back to bisection if the interpolation does not converge fast enough.
+// Each probe takes the median date of a few messages, so single messages
+// with a wrong date do not lead the search astray, and probes hitting
+// expired messages are widened until they hit existing ones. Once the
+// bracketing messages are at most ScanTolerance messages apart, the
+// messages in between are scanned one by one.
+func (s *Searcher) scanForDate(c *conn, firstMessageID int, lastMessageID int, date time.Time, first bool) (Boundary, error) {
+	target := date.Unix()
+	probes := 0
+	probeAt := func(number int, limit int) (probe, bool, error) {
+		probes++
+		return s.probe(c, number, limit)
+	}
+
+	lo, ok, err := probeAt(firstMessageID, lastMessageID)
+	if err != nil {
+		return Boundary{}, err
+	}
+	if !ok {
+		return Boundary{}, errors.New("no messages found in group")
+	}
+	if lo.date > target {
+		if !first {
+			return Boundary{}, errors.New("post date is older than oldest message of this group")
+		}
+		return s.firstNewer(c, firstMessageID, lo.number, target, probes)
+	}
+	hi, ok, err := probeAt(lastMessageID-probeSize+1, lastMessageID)
+	if err != nil {
+		return Boundary{}, err
+	}
+	if !ok || hi.date <= target {
+		// all messages are older than the date, the last message is the boundary
+		return s.lastMessage(c, lo.number, lastMessageID, probes)
+	}
+	hi.number = lastMessageID
+	// upper is the last probe hitting existing messages newer than the date
+	upper := hi
+
+	// narrow down the range using the cached dates, if any
+	if cachedFirst, cachedLast, ok := s.cachedRange(c, lo.number, hi.number, target); ok {
+		if p, ok, err := probeAt(cachedFirst, hi.number); err == nil && ok && p.date <= target && p.number < hi.number {
+			lo = p
+		}
+		if p, ok, err := probeAt(cachedLast, hi.number); err == nil && ok && p.date > target && p.number > lo.number {
+			hi = p
+		}
+	}
+
+	bisect := false
+	for hi.number-lo.number > s.opts.ScanTolerance {
+		if probes >= maxProbes {
+			return Boundary{}, errors.New("maximum number of probes exceeded")
+		}
+		width := hi.number - lo.number
+		var next int
+		if bisect || hi.date <= lo.date {
+			next = lo.number + width/2
+		} else {
+			next = lo.number + int(float64(width)*float64(target-lo.date)/float64(hi.date-lo.date))
+		}
+		if next <= lo.number {
+			next = lo.number + 1
+		} else if next >= hi.number {
+			next = hi.number - 1
+		}
+		s.debugf("Scanning message no.: %d | Range: %d - %d\n", next, lo.number, hi.number)
+		p, ok, err := probeAt(next, hi.number-1)
+		if err != nil {
+			return Boundary{}, err
+		}
+		switch {
+		case !ok:
+			// all messages between next and hi are expired
+			hi.number = next
+		case p.date <= target:
+			lo = p
+		default:
+			hi, upper = p, p
+		}
+		// bisect next time if the range did not shrink to at least half
+		bisect = hi.number-lo.number > width/2
+	}
+	s.debugf("Scanning messages %d to %d one by one\n", lo.number, hi.number)
+	boundary, err := s.firstNewer(c, lo.number, hi.number, target, probes)
+	if err != nil || boundary.Date.Unix() > target || hi.number >= upper.number {
+		return boundary, err
+	}
+	// the messages from hi on are expired up to the messages of the last probe
+	return s.firstNewer(c, hi.number, upper.number, target, boundary.Probes)
+}
+
+// probe returns the message with the median date of the first messages
+// from number on. If there are no messages, the range is widened up to
+// limit. ok is false if there are no messages between number and limit.
+func (s *Searcher) probe(c *conn, number int, limit int) (probe, bool, error) {
+	if number < c.firstMessageID {
+		number = c.firstMessageID
+	}
+	for size := probeSize; ; size *= 2 {
+		last := number + size - 1
+		if last > limit {
+			last = limit
+		}
+		if last < number {
+			return probe{}, false, nil
+		}
+		results, err := s.overview(c, number, last)
+		if err != nil && !isNoArticles(err) {
+			return probe{}, false, err
+		}
+		if p, ok := medianDate(results); ok {
+			s.addDateSample(c, p.number, time.Unix(p.date, 0))
+			return p, true, nil
+		}
+		if last == limit {
+			return probe{}, false, nil
+		}
+	}
+}
+
+// medianDate returns the number and the date of the message with the
+// median date of the messages with a valid date.
+func medianDate(results []nntp.MessageOverview) (probe, bool) {
+	probes := make([]probe, 0, len(results))
+	for _, overview := range results {
+		if !overview.Date.IsZero() {
+			probes = append(probes, probe{number: overview.MessageNumber, date: overview.Date.Unix()})
+		}
+	}
+	if len(probes) == 0 {
+		return probe{}, false
+	}
+	sort.SliceStable(probes, func(i, j int) bool { return probes[i].date < probes[j].date })
+	return probes[len(probes)/2], true
+}
+
+// firstNewer returns the first message between first and last newer than
+// target, or the last message if there is none.
+func (s *Searcher) firstNewer(c *conn, first int, last int, target int64, probes int) (Boundary, error) {
+	results, err := s.overview(c, first, last)
+	probes++
+	if err != nil && !isNoArticles(err) {
+		return Boundary{}, err
+	}
+	for _, overview := range results {
+		if overview.Date.Unix() > target {
+			s.addDateSample(c, overview.MessageNumber, overview.Date)
+			return Boundary{Number: overview.MessageNumber, Date: overview.Date, Probes: probes}, nil
+		}
+	}
+	if len(results) > 0 {
+		overview := results[len(results)-1]
+		return Boundary{Number: overview.MessageNumber, Date: overview.Date, Probes: probes}, nil
+	}
+	return Boundary{Number: last, Probes: probes}, nil
+}
+
+// lastMessage returns the last message between first and last.
+func (s *Searcher) lastMessage(c *conn, first int, last int, probes int) (Boundary, error) {
+	for size := probeSize; ; size *= 2 {
+		from := last - size + 1
+		if from < first {
+			from = first
+		}
+		results, err := s.overview(c, from, last)
+		probes++
+		if err != nil && !isNoArticles(err) {
+			return Boundary{}, err
+		}
+		if len(results) > 0 {
+			overview := results[len(results)-1]
+			return Boundary{Number: overview.MessageNumber, Date: overview.Date, Probes: probes}, nil
+		}
+		if from == first {
+			return Boundary{Number: last, Probes: probes}, nil
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package searcher
+
+import (
+	"context"
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// MergeHeaders merges the headers found in several groups, i.e. the headers
+// of posts cross-posted to these groups, into one header per post. The
+// files of the merged headers list all groups they were found in and
+// messages found in several groups are kept only once. The headers passed
+// are not modified. The merged headers are sorted by name.
+func MergeHeaders(headers []*Header) []*Header {
+	var merged []*Header
+	byHash := make(map[string]*Header)
+	for _, hdr := range headers {
+		m, ok := byHash[hdr.Hash]
+		if !ok {
+			m = &Header{Name: hdr.Name, Hash: hdr.Hash, Query: hdr.Query, FilesByHash: make(map[string]*File)}
+			byHash[hdr.Hash] = m
+			merged = append(merged, m)
+		}
+		for hash, f := range hdr.FilesByHash {
+			mf, ok := m.FilesByHash[hash]
+			if !ok {
+				fileCopy := *f
+				fileCopy.Groups = nil
+				fileCopy.Messages = nil
+				mf = &fileCopy
+				m.FilesByHash[hash] = mf
+			}
+			mf.Groups = addGroups(mf.Groups, f.Groups...)
+			if f.Date > 0 && (mf.Date == 0 || f.Date < mf.Date) {
+				mf.Date = f.Date
+			}
+			mf.Messages = addMessages(mf.Messages, f.Messages...)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Name != merged[j].Name {
+			return merged[i].Name < merged[j].Name
+		}
+		return merged[i].Hash < merged[j].Hash
+	})
+	return merged
+}
+
+// addGroups adds the groups not yet in groups.
+func addGroups(groups []string, add ...string) []string {
+	for _, group := range add {
+		found := false
+		for _, g := range groups {
+			if g == group {
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// addMessages adds the messages with a message id not yet in messages.
+func addMessages(messages []Message, add ...Message) []Message {
+	ids := make(map[string]bool, len(messages))
+	for _, msg := range messages {
+		ids[msg.MessageId] = true
+	}
+	for _, msg := range add {
+		if !ids[msg.MessageId] {
+			ids[msg.MessageId] = true
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// xrefGroups returns the groups listed in the Xref header of a message
+// overview, e.g. "Xref: news.example.com alt.binaries.a:123 alt.binaries.b:456".
+func xrefGroups(extra []string) []string {
+	for _, field := range extra {
+		if len(field) < 5 || !strings.EqualFold(field[:5], "xref:") {
+			continue
+		}
+		var groups []string
+		// the first entry is the name of the server
+		for n, entry := range strings.Fields(field[5:]) {
+			if n == 0 {
+				continue
+			}
+			if i := strings.Index(entry, ":"); i > 0 {
+				groups = append(groups, entry[:i])
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// Newsgroups adds the groups listed in the Newsgroups header of the first
+// message of every file of hdr to the groups of the file. The header is
+// retrieved with a HEAD request from the servers in order of their
+// priority. hdr must not be used concurrently.
+func (s *Searcher) Newsgroups(ctx context.Context, hdr *Header) error {
+	for _, f := range hdr.FilesByHash {
+		if len(f.Messages) == 0 {
+			continue
+		}
+		newsgroups, err := s.newsgroups(ctx, f.Messages[0].MessageId)
+		if err != nil {
+			return err
+		}
+		f.Groups = addGroups(f.Groups, newsgroups...)
+	}
+	return nil
+}
+
+func (s *Searcher) newsgroups(ctx context.Context, messageID string) ([]string, error) {
+	var newsgroups []string
+	err := s.onAnyServer(ctx, fmt.Sprintf("retrieving header of article <%s>", messageID), func(c *conn) error {
+		article, err := c.Head("<" + messageID + ">")
+		if err != nil {
+			return err
+		}
+		newsgroups = nil
+		for _, group := range strings.Split(textproto.MIMEHeader(article.Header).Get("Newsgroups"), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				newsgroups = append(newsgroups, group)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newsgroups, nil
+}
@@ -0,0 +1,280 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/Tensai75/nntp"
+)
+
+// connection idle for longer than this are health-checked before being reused
+const healthCheckAfter = 30 * time.Second
+
+// conn is a pooled connection to the usenet server.
+type conn struct {
+	*nntp.Conn
+	server         string
+	group          string
+	firstMessageID int
+	lastMessageID  int
+	lastUsed       time.Time
+	// abandoned is set if the response to the last command was not read
+	// to the end, see abandon.
+	abandoned bool
+}
+
+// pool keeps authenticated connections to the usenet server alive so they
+// can be reused. The capacity of guard limits the number of connections
+// open at the same time.
+type pool struct {
+	server Server
+	guard  chan struct{}
+
+	mutex sync.Mutex
+	idle  []*conn
+}
+
+func newPool(server Server) *pool {
+	return &pool{
+		server: server,
+		guard:  make(chan struct{}, server.Connections),
+	}
+}
+
+// get returns an idle connection or dials a new one if none is available.
+// It blocks if the maximum number of connections is in use until a
+// connection is returned to the pool or ctx is done.
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	select {
+	case p.guard <- struct{}{}: // will block if guard channel is already filled
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	for {
+		p.mutex.Lock()
+		if len(p.idle) == 0 {
+			p.mutex.Unlock()
+			break
+		}
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mutex.Unlock()
+		if time.Since(c.lastUsed) < healthCheckAfter {
+			return c, nil
+		}
+		if _, err := c.Date(); err == nil {
+			return c, nil
+		}
+		// connection is broken, replace it
+		c.Quit()
+	}
+	c, err := p.dial()
+	if err != nil {
+		<-p.guard
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *pool) dial() (*conn, error) {
+	var nntpConn *nntp.Conn
+	var err error
+	address := p.server.Host + ":" + strconv.Itoa(p.server.Port)
+	if p.server.SSL {
+		nntpConn, err = nntp.DialTLS("tcp", address, nil)
+	} else {
+		nntpConn, err = nntp.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := nntpConn.Authenticate(p.server.User, p.server.Password); err != nil {
+		nntpConn.Quit()
+		return nil, err
+	}
+	return &conn{Conn: nntpConn, server: p.server.String(), lastUsed: time.Now()}, nil
+}
+
+// put returns c to the pool. If err is the error returned by the last
+// command sent on c and indicates a broken connection, c is closed
+// instead.
+func (p *pool) put(c *conn, err error) {
+	if c == nil {
+		return
+	}
+	switch {
+	case c.abandoned:
+		c.closeNow()
+	case isConnectionError(err) || errors.Is(err, errAbandoned):
+		c.Quit()
+	default:
+		c.lastUsed = time.Now()
+		p.mutex.Lock()
+		p.idle = append(p.idle, c)
+		p.mutex.Unlock()
+	}
+	<-p.guard
+}
+
+// abandon marks c to be closed as soon as it is returned to the pool,
+// without reading the rest of the response to the last command, e.g. the
+// rest of an article body which is not needed.
+func (c *conn) abandon() {
+	c.abandoned = true
+}
+
+// netConnType is the type of the network connection of an nntp.Conn.
+var netConnType = reflect.TypeOf((*net.Conn)(nil)).Elem()
+
+// closeNow closes the network connection of c without sending QUIT, as
+// the nntp package reads the rest of an unread article body before sending
+// the next command. The network connection is not exported by the nntp
+// package, so it is taken from its unexported field. If the field is not
+// found, c is closed with QUIT.
+func (c *conn) closeNow() {
+	field := reflect.ValueOf(c.Conn).Elem().FieldByName("conn")
+	if !field.IsValid() || field.Type() != netConnType {
+		c.Quit()
+		return
+	}
+	netConn := reflect.NewAt(netConnType, unsafe.Pointer(field.UnsafeAddr())).Elem().Interface().(net.Conn)
+	netConn.Close()
+}
+
+// close quits all idle connections.
+func (p *pool) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, c := range p.idle {
+		c.Quit()
+	}
+	p.idle = nil
+}
+
+// isConnectionError reports whether err leaves the connection in an
+// unusable state, i.e. a network error or a garbled response.
+// NNTP error responses do not.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	var protocolErr nntp.ProtocolError
+	return errors.As(err, &netErr) || errors.As(err, &protocolErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// errAbandoned marks a connection whose request was abandoned because the
+// context was done. Its state is unknown, so it must not be reused.
+var errAbandoned = errors.New("request abandoned")
+
+// request runs f on a connection of the pool with group selected. If group
+// is empty, no group is selected. The GROUP command is only sent if the
+// connection is not already in group.
+//
+// The NNTP commands can not be interrupted, so if ctx is done before f
+// returns, request returns the error of ctx right away and the connection
+// is closed as soon as f has returned.
+func (p *pool) request(ctx context.Context, group string, f func(c *conn) error) error {
+	c, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := c.switchToGroup(group)
+		if err == nil {
+			err = f(c)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		p.put(c, err)
+		return err
+	case <-ctx.Done():
+		go func() {
+			<-done
+			p.put(c, errAbandoned)
+		}()
+		return ctx.Err()
+	}
+}
+
+// switchToGroup selects group on the connection, unless it is already
+// selected.
+func (c *conn) switchToGroup(group string) error {
+	if group == "" || c.group == group {
+		return nil
+	}
+	_, firstMessageID, lastMessageID, err := c.Group(group)
+	if err != nil {
+		c.group = ""
+		return err
+	}
+	c.group, c.firstMessageID, c.lastMessageID = group, firstMessageID, lastMessageID
+	return nil
+}
+
+// onAnyServer runs f on a connection to the servers in order of their
+// priority, with retries, until it succeeds on one of them. description
+// describes the request in the log messages. If f fails on all servers, the
+// last error is returned, an error for a missing article only if no server
+// failed otherwise.
+func (s *Searcher) onAnyServer(ctx context.Context, description string, f func(c *conn) error) error {
+	err := errors.New("no usenet server given")
+	for i, p := range s.pools {
+		requestErr := s.withRetry(ctx, fmt.Sprintf("%s on server %s", description, p.server), func() error {
+			return p.request(ctx, "", f)
+		})
+		if requestErr == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.debugf("Error %s on server %s: %v\n", description, p.server, requestErr)
+		if i == 0 || !isNoSuchArticle(requestErr) {
+			err = requestErr
+		}
+	}
+	return err
+}
+
+// ListGroups returns the names of all active groups on the usenet server
+// matching the wildmat filter. An empty filter returns all groups.
+// The servers are tried in order of their priority.
+func (s *Searcher) ListGroups(ctx context.Context, filter string) ([]string, error) {
+	var (
+		groupsList []string
+		err        error
+	)
+	for _, p := range s.pools {
+		s.debugf("Connecting to usenet server %s to get groups list\n", p.server)
+		err = p.request(ctx, "", func(c *conn) (err error) {
+			groupsList, err = c.List("ACTIVE", filter)
+			return err
+		})
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, group := range groupsList {
+		groupData := strings.Split(string(group), " ")
+		groups = append(groups, groupData[0])
+	}
+	return groups, nil
+}
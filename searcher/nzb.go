@@ -0,0 +1,288 @@
+package searcher
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nzbDoctype   = `<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">` + "\n"
+	nzbNamespace = "http://www.newzbin.com/DTD/2003/nzb"
+	nzbComment   = " NZB file created by https://github.com/Tensai75/nzbsearcher, coded by Tensai "
+)
+
+// nzbDocument is the structure of an NZB file.
+type nzbDocument struct {
+	XMLName xml.Name    `xml:"nzb"`
+	Xmlns   string      `xml:"xmlns,attr,omitempty"`
+	Comment xml.Comment `xml:",comment"`
+	Head    nzbHead     `xml:"head"`
+	Files   []nzbFile   `xml:"file"`
+}
+
+type nzbHead struct {
+	Meta []nzbMeta `xml:"meta"`
+}
+
+type nzbMeta struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type nzbFile struct {
+	Poster   string       `xml:"poster,attr"`
+	Date     int64        `xml:"date,attr"`
+	Subject  string       `xml:"subject,attr"`
+	Groups   []string     `xml:"groups>group"`
+	Segments []nzbSegment `xml:"segments>segment"`
+}
+
+type nzbSegment struct {
+	Bytes     int    `xml:"bytes,attr"`
+	Number    int    `xml:"number,attr"`
+	MessageID string `xml:",chardata"`
+}
+
+// NZBMeta holds the information written to the head of an NZB file. Empty
+// fields are not written.
+type NZBMeta struct {
+	// Title is the name of the download, Category its category and
+	// Password the password of its archives, as used by downloaders.
+	Title    string
+	Category string
+	Password string
+	// Query, Groups, Server, From and To record the search the header was
+	// found with.
+	Query  string
+	Groups []string
+	Server string
+	From   time.Time
+	To     time.Time
+	// Partial marks the NZB file as created from an interrupted search.
+	Partial bool
+	// Completeness is the completeness report of the header, if not nil.
+	Completeness *Completeness
+	// Availability is the availability of the files of the header on the
+	// servers. Files not completely available are flagged.
+	Availability []FileAvailability
+}
+
+func (meta NZBMeta) head() nzbHead {
+	var head nzbHead
+	add := func(metaType string, value string) {
+		if value != "" {
+			head.Meta = append(head.Meta, nzbMeta{Type: metaType, Value: value})
+		}
+	}
+	add("title", meta.Title)
+	add("category", meta.Category)
+	add("password", meta.Password)
+	add("query", meta.Query)
+	add("groups", strings.Join(sortedGroups(meta.Groups), ","))
+	add("server", meta.Server)
+	if !meta.From.IsZero() {
+		add("from", meta.From.Format(time.RFC3339))
+	}
+	if !meta.To.IsZero() {
+		add("to", meta.To.Format(time.RFC3339))
+	}
+	if meta.Partial {
+		head.Meta = append(head.Meta, nzbMeta{Type: "partial", Value: "true"})
+	}
+	if meta.Completeness != nil {
+		head.Meta = append(head.Meta, nzbMeta{Type: "completeness", Value: meta.Completeness.String()})
+		for _, detail := range meta.Completeness.Details() {
+			head.Meta = append(head.Meta, nzbMeta{Type: "incomplete", Value: detail})
+		}
+	}
+	for _, availability := range meta.Availability {
+		if !availability.Complete() {
+			head.Meta = append(head.Meta, nzbMeta{Type: "unavailable", Value: availability.String()})
+		}
+	}
+	return head
+}
+
+// WriteNZB writes the NZB file for hdr to w. The output only depends on the
+// files and segments of hdr, not on the order they were found in: the files
+// are sorted by their number and name with the par2 files last, the
+// segments are sorted by their number and segments found more than once are
+// written only once.
+func WriteNZB(w io.Writer, hdr *Header, meta NZBMeta) error {
+	doc := nzbDocument{
+		Xmlns:   nzbNamespace,
+		Comment: xml.Comment(nzbComment),
+		Head:    meta.head(),
+	}
+	for _, f := range sortedFiles(hdr) {
+		date, subject := fileDateAndSubject(f)
+		doc.Files = append(doc.Files, nzbFile{
+			Poster:   f.Poster,
+			Date:     date,
+			Subject:  subject,
+			Groups:   sortedGroups(f.Groups),
+			Segments: sortedSegments(f.Messages),
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header+nzbDoctype); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// sortedFiles returns the files of hdr sorted by their number and name,
+// with the par2 files last.
+func sortedFiles(hdr *Header) []*File {
+	files := make([]*File, 0, len(hdr.FilesByHash))
+	for _, f := range hdr.FilesByHash {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if aPar2, bPar2 := isPar2(a.Name), isPar2(b.Name); aPar2 != bPar2 {
+			return bPar2
+		}
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Subject != b.Subject {
+			return a.Subject < b.Subject
+		}
+		return a.Hash < b.Hash
+	})
+	return files
+}
+
+// fileDateAndSubject returns the date of the first message posted of f and
+// the subject of its first segment.
+func fileDateAndSubject(f *File) (int64, string) {
+	date, subject := f.Date, f.Subject
+	var first *Message
+	for i, msg := range f.Messages {
+		if msg.Date > 0 && (i == 0 || msg.Date < date) {
+			date = msg.Date
+		}
+		if first == nil || msg.SegmentNo < first.SegmentNo || msg.SegmentNo == first.SegmentNo && msg.MessageId < first.MessageId {
+			first = &f.Messages[i]
+		}
+	}
+	if first != nil && first.Subject != "" {
+		subject = first.Subject
+	}
+	return date, subject
+}
+
+func isPar2(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(filename), ".par2")
+}
+
+// sortedGroups returns the groups sorted and without duplicates.
+func sortedGroups(groups []string) []string {
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+	unique := sorted[:0]
+	for i, group := range sorted {
+		if i == 0 || group != sorted[i-1] {
+			unique = append(unique, group)
+		}
+	}
+	return unique
+}
+
+// sortedSegments returns the segments of the messages sorted by their
+// number. Of the messages with the same segment number, only the one with
+// the lowest message id is kept.
+func sortedSegments(messages []Message) []nzbSegment {
+	segments := make([]nzbSegment, len(messages))
+	for i, msg := range messages {
+		segments[i] = nzbSegment{Bytes: msg.Bytes, Number: msg.SegmentNo, MessageID: msg.MessageId}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].Number != segments[j].Number {
+			return segments[i].Number < segments[j].Number
+		}
+		return segments[i].MessageID < segments[j].MessageID
+	})
+	unique := segments[:0]
+	for i, segment := range segments {
+		if i == 0 || segment.Number != segments[i-1].Number {
+			unique = append(unique, segment)
+		}
+	}
+	return unique
+}
+
+// ReadNZB reads an NZB file from r and returns its files as a header named
+// name. The file names are taken from the subjects of the files.
+func ReadNZB(r io.Reader, name string) (*Header, error) {
+	var doc nzbDocument
+	decoder := xml.NewDecoder(r)
+	// NZB files declared with another encoding than UTF-8 are read as is
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid NZB file: %w", err)
+	}
+	if len(doc.Files) == 0 {
+		return nil, fmt.Errorf("invalid NZB file: no files")
+	}
+	hdr := &Header{
+		Name:        name,
+		Hash:        getMD5Hash(name),
+		FilesByHash: make(map[string]*File, len(doc.Files)),
+	}
+	for i, file := range doc.Files {
+		f := &File{
+			Name:     subjectFilename(file.Subject),
+			Hash:     getMD5Hash(strconv.Itoa(i) + file.Subject),
+			Poster:   file.Poster,
+			Subject:  file.Subject,
+			Date:     file.Date,
+			Groups:   file.Groups,
+			Number:   i + 1,
+			Messages: make([]Message, 0, len(file.Segments)),
+		}
+		for _, segment := range file.Segments {
+			f.Messages = append(f.Messages, Message{
+				Subject:       file.Subject,
+				MessageId:     strings.Trim(strings.TrimSpace(segment.MessageID), "<>"),
+				From:          file.Poster,
+				Bytes:         segment.Bytes,
+				Date:          file.Date,
+				Filename:      f.Name,
+				FileNo:        f.Number,
+				TotalFiles:    len(doc.Files),
+				SegmentNo:     segment.Number,
+				TotalSegments: len(file.Segments),
+			})
+		}
+		hdr.FilesByHash[f.Hash] = f
+	}
+	return hdr, nil
+}
+
+// subjectFilename returns the file name given in subject or the subject
+// itself if it does not contain a file name.
+func subjectFilename(subject string) string {
+	if matches := findNamedMatches(quotedFilenamePattern, subject); matches != nil {
+		if filename := strings.Trim(matches["filename"], " -\""); filename != "" {
+			return filename
+		}
+	}
+	return subject
+}
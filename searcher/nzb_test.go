@@ -0,0 +1,119 @@
+package searcher
+
+import (
+	"bytes"
+	"testing"
+)
+
+// nzbTestFiles are the files of the header written in TestWriteNZB: a par2
+// file with the lowest number, two rar files and a duplicate segment.
+func nzbTestFiles() []*File {
+	return []*File{
+		{
+			Name: "show.par2", Hash: "c", Number: 0, Poster: "poster <p@example.com>",
+			Subject: `Show & Co [3/3] - "show.par2" yEnc (1/1)`, Groups: []string{"alt.binaries.b&w"},
+			Messages: []Message{
+				{MessageId: "par2@example.com", Bytes: 50, Date: 1003, SegmentNo: 1, Subject: `Show & Co [3/3] - "show.par2" yEnc (1/1)`},
+			},
+		},
+		{
+			Name: "show.part2.rar", Hash: "b", Number: 2, Poster: "poster <p@example.com>",
+			Subject: `Show & Co [2/3] - "show.part2.rar" yEnc (2/2)`, Groups: []string{"alt.binaries.test", "alt.binaries.b&w", "alt.binaries.test"},
+			Messages: []Message{
+				{MessageId: "part2-2@example.com", Bytes: 100, Date: 1002, SegmentNo: 2, Subject: `Show & Co [2/3] - "show.part2.rar" yEnc (2/2)`},
+				{MessageId: "part2-1b@example.com", Bytes: 200, Date: 1001, SegmentNo: 1, Subject: `Show & Co [2/3] - "show.part2.rar" yEnc (1/2)`},
+				// the same segment posted twice, only the lower message id
+				// is written
+				{MessageId: "part2-1a@example.com", Bytes: 200, Date: 1005, SegmentNo: 1, Subject: `Show & Co [2/3] - "show.part2.rar" yEnc (1/2)`},
+			},
+		},
+		{
+			Name: "show.part1.rar", Hash: "a", Number: 1, Poster: "poster <p@example.com>",
+			Subject: `Show & Co [1/3] - "show.part1.rar" yEnc (1/1)`, Groups: []string{"alt.binaries.b&w"},
+			Messages: []Message{
+				{MessageId: "part1@example.com", Bytes: 300, Date: 1000, SegmentNo: 1, Subject: `Show & Co [1/3] - "show.part1.rar" yEnc (1/1)`},
+			},
+		},
+	}
+}
+
+// nzbTestWant is the NZB file written for the files of nzbTestFiles,
+// independent of the order they were found in.
+const nzbTestWant = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <!-- NZB file created by https://github.com/Tensai75/nzbsearcher, coded by Tensai -->
+  <head>
+    <meta type="title">Show &amp; Co</meta>
+    <meta type="groups">alt.binaries.b&amp;w,alt.binaries.test</meta>
+  </head>
+  <file poster="poster &lt;p@example.com&gt;" date="1000" subject="Show &amp; Co [1/3] - &#34;show.part1.rar&#34; yEnc (1/1)">
+    <groups>
+      <group>alt.binaries.b&amp;w</group>
+    </groups>
+    <segments>
+      <segment bytes="300" number="1">part1@example.com</segment>
+    </segments>
+  </file>
+  <file poster="poster &lt;p@example.com&gt;" date="1001" subject="Show &amp; Co [2/3] - &#34;show.part2.rar&#34; yEnc (1/2)">
+    <groups>
+      <group>alt.binaries.b&amp;w</group>
+      <group>alt.binaries.test</group>
+    </groups>
+    <segments>
+      <segment bytes="200" number="1">part2-1a@example.com</segment>
+      <segment bytes="100" number="2">part2-2@example.com</segment>
+    </segments>
+  </file>
+  <file poster="poster &lt;p@example.com&gt;" date="1003" subject="Show &amp; Co [3/3] - &#34;show.par2&#34; yEnc (1/1)">
+    <groups>
+      <group>alt.binaries.b&amp;w</group>
+    </groups>
+    <segments>
+      <segment bytes="50" number="1">par2@example.com</segment>
+    </segments>
+  </file>
+</nzb>
+`
+
+func TestWriteNZB(t *testing.T) {
+	tests := []struct {
+		name string
+		// order is the order the files are added to the header in
+		order           []int
+		reverseMessages bool
+	}{
+		{name: "found in order", order: []int{2, 1, 0}},
+		{name: "par2 found first", order: []int{0, 1, 2}},
+		{name: "segments reversed", order: []int{1, 0, 2}, reverseMessages: true},
+	}
+	meta := NZBMeta{Title: "Show & Co", Groups: []string{"alt.binaries.test", "alt.binaries.b&w"}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := nzbTestFiles()
+			hdr := &Header{Name: "Show & Co", FilesByHash: make(map[string]*File)}
+			for _, i := range test.order {
+				f := files[i]
+				if test.reverseMessages {
+					for i, j := 0, len(f.Messages)-1; i < j; i, j = i+1, j-1 {
+						f.Messages[i], f.Messages[j] = f.Messages[j], f.Messages[i]
+					}
+				}
+				hdr.FilesByHash[f.Hash] = f
+			}
+			var first, second bytes.Buffer
+			if err := WriteNZB(&first, hdr, meta); err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteNZB(&second, hdr, meta); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(first.Bytes(), second.Bytes()) {
+				t.Errorf("two writes differ:\n%s\n%s", first.String(), second.String())
+			}
+			if got := first.String(); got != nzbTestWant {
+				t.Errorf("WriteNZB wrote\n%s\nwant\n%s", got, nzbTestWant)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package searcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PAR2 packet header: magic sequence, packet length, packet hash, recovery
+// set id and packet type
+const (
+	par2HeaderLength = 64
+	par2Magic        = "PAR2\x00PKT"
+	par2FileDesc     = "PAR 2.0\x00FileDesc"
+	// length of the start of a file hashed in the file description
+	par2HashLength = 16 * 1024
+)
+
+// par2Volume matches the names of PAR2 recovery volumes.
+var par2Volume = regexp.MustCompile(`(?i)\.vol\d+[+-]\d+\.par2$`)
+
+// Par2File is a file described in a PAR2 file.
+type Par2File struct {
+	ID   [16]byte
+	Name string
+	Size int64
+	// Hash is the MD5 hash of the file, Hash16k the MD5 hash of its first
+	// 16 KiB.
+	Hash    [16]byte
+	Hash16k [16]byte
+}
+
+// ParsePar2 returns the files described in the file description packets of
+// the PAR2 file data. Damaged packets are skipped.
+func ParsePar2(data []byte) ([]Par2File, error) {
+	var files []Par2File
+	ids := make(map[[16]byte]bool)
+	for len(data) >= par2HeaderLength {
+		start := bytes.Index(data, []byte(par2Magic))
+		if start < 0 {
+			break
+		}
+		data = data[start:]
+		if len(data) < par2HeaderLength {
+			break
+		}
+		length := binary.LittleEndian.Uint64(data[8:16])
+		if length < par2HeaderLength || length%4 != 0 || length > uint64(len(data)) {
+			// damaged packet, search for the next one
+			data = data[len(par2Magic):]
+			continue
+		}
+		packet := data[:length]
+		if hash := md5.Sum(packet[32:]); !bytes.Equal(hash[:], packet[16:32]) {
+			data = data[len(par2Magic):]
+			continue
+		}
+		data = data[length:]
+		if string(packet[48:64]) != par2FileDesc || length < par2HeaderLength+56 {
+			continue
+		}
+		body := packet[par2HeaderLength:]
+		var f Par2File
+		copy(f.ID[:], body[0:16])
+		if ids[f.ID] {
+			// packets are repeated in PAR2 files
+			continue
+		}
+		ids[f.ID] = true
+		copy(f.Hash[:], body[16:32])
+		copy(f.Hash16k[:], body[32:48])
+		f.Size = int64(binary.LittleEndian.Uint64(body[48:56]))
+		f.Name = strings.TrimRight(string(body[56:]), "\x00")
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no file description found in PAR2 file")
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// Par2Report is the result of matching the files of a header with the
+// files described in its PAR2 index file.
+type Par2Report struct {
+	// Files are the files described in the PAR2 file.
+	Files []Par2File
+	// Renamed maps the names of the files renamed to their new names.
+	Renamed map[string]string
+	// Missing are the files described in the PAR2 file not found.
+	Missing []Par2File
+	// ExpectedSize is the total size of the files described in the PAR2
+	// file, FoundSize the total size of those found.
+	ExpectedSize int64
+	FoundSize    int64
+}
+
+// ApplyPar2 downloads the PAR2 index file of hdr and matches the files of
+// hdr with the files described in it, by name, by size (if known) or by the
+// hash of their first 16 KiB. It returns a copy of hdr with the files
+// matched renamed to the names given in the PAR2 file and a report of the
+// files found and missing.
+func (s *Searcher) ApplyPar2(ctx context.Context, hdr *Header) (*Header, *Par2Report, error) {
+	index := par2Index(hdr)
+	if index == nil {
+		return nil, nil, errors.New("no PAR2 index file found")
+	}
+	data, err := s.download(ctx, index, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error downloading PAR2 file '%s': %w", index.Name, err)
+	}
+	par2Files, err := ParsePar2(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing PAR2 file '%s': %w", index.Name, err)
+	}
+	report := &Par2Report{Files: par2Files, Renamed: make(map[string]string)}
+	// the data files, sorted for a deterministic matching
+	var files []*File
+	for _, f := range sortedFiles(hdr) {
+		if !isPar2(f.Name) {
+			files = append(files, f)
+		}
+	}
+	matches := make(map[*File]*Par2File)
+	matched := make(map[int]bool)
+	match := func(f *File, i int) {
+		matches[f] = &par2Files[i]
+		matched[i] = true
+	}
+	// match by name
+	for _, f := range files {
+		for i := range par2Files {
+			if !matched[i] && par2Files[i].Name == f.Name {
+				match(f, i)
+				break
+			}
+		}
+	}
+	// match by size if unique
+	for _, f := range files {
+		if matches[f] != nil || f.Size <= 0 {
+			continue
+		}
+		found := -1
+		for i := range par2Files {
+			if !matched[i] && par2Files[i].Size == f.Size {
+				if found >= 0 {
+					found = -1
+					break
+				}
+				found = i
+			}
+		}
+		if found >= 0 {
+			match(f, found)
+		}
+	}
+	// match by the hash of the first 16 KiB
+	for _, f := range files {
+		if matches[f] != nil || len(matched) == len(par2Files) || ctx.Err() != nil {
+			continue
+		}
+		start, err := s.download(ctx, f, par2HashLength)
+		if err != nil {
+			s.logf("Error downloading the start of file '%s': %v\n", f.Name, err)
+			continue
+		}
+		if len(start) > par2HashLength {
+			start = start[:par2HashLength]
+		}
+		hash := md5.Sum(start)
+		for i := range par2Files {
+			if !matched[i] && par2Files[i].Hash16k == hash {
+				match(f, i)
+				break
+			}
+		}
+	}
+	renamed := &Header{Name: hdr.Name, Hash: hdr.Hash, Query: hdr.Query, FilesByHash: make(map[string]*File, len(hdr.FilesByHash))}
+	for hash, f := range hdr.FilesByHash {
+		par2File := matches[f]
+		if par2File == nil || par2File.Name == f.Name {
+			renamed.FilesByHash[hash] = f
+			continue
+		}
+		report.Renamed[f.Name] = par2File.Name
+		fileCopy := *f
+		fileCopy.Name = par2File.Name
+		fileCopy.Size = par2File.Size
+		fileCopy.Subject = renameSubject(f.Subject, f.Name, par2File.Name)
+		fileCopy.Messages = make([]Message, len(f.Messages))
+		for i, msg := range f.Messages {
+			msg.Filename = par2File.Name
+			msg.Subject = renameSubject(msg.Subject, f.Name, par2File.Name)
+			fileCopy.Messages[i] = msg
+		}
+		renamed.FilesByHash[hash] = &fileCopy
+	}
+	for i, f := range par2Files {
+		report.ExpectedSize += f.Size
+		if matched[i] {
+			report.FoundSize += f.Size
+		} else {
+			report.Missing = append(report.Missing, f)
+		}
+	}
+	return renamed, report, nil
+}
+
+// par2Index returns the PAR2 index file of hdr, i.e. the smallest PAR2
+// file which is not a recovery volume, or nil if there is none.
+func par2Index(hdr *Header) *File {
+	var index *File
+	for _, f := range sortedFiles(hdr) {
+		if !isPar2(f.Name) {
+			continue
+		}
+		if index == nil || par2Volume.MatchString(index.Name) && !par2Volume.MatchString(f.Name) ||
+			par2Volume.MatchString(index.Name) == par2Volume.MatchString(f.Name) && len(f.Messages) < len(index.Messages) {
+			index = f
+		}
+	}
+	return index
+}
+
+// download downloads and decodes the segments of f in the order of their
+// numbers. If max is greater than 0, the download stops as soon as at least
+// max bytes have been decoded.
+func (s *Searcher) download(ctx context.Context, f *File, max int) ([]byte, error) {
+	var data []byte
+	for _, segment := range sortedSegments(f.Messages) {
+		part, err := s.decodeArticle(ctx, segment.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, part...)
+		if max > 0 && len(data) >= max {
+			break
+		}
+	}
+	return data, nil
+}
+
+// decodeArticle retrieves the article with the message id from the servers
+// in order of their priority and decodes its yEnc encoded body.
+func (s *Searcher) decodeArticle(ctx context.Context, messageID string) ([]byte, error) {
+	var data []byte
+	err := s.onAnyServer(ctx, fmt.Sprintf("decoding article <%s>", messageID), func(c *conn) error {
+		body, err := c.Body("<" + messageID + ">")
+		if err != nil {
+			return err
+		}
+		_, data, err = DecodeYEnc(body)
+		// the rest of the body must be read for the connection to be
+		// reusable
+		if _, copyErr := io.Copy(io.Discard, body); copyErr != nil {
+			return copyErr
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
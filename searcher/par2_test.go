@@ -0,0 +1,83 @@
+package searcher
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"testing"
+)
+
+// par2Packet returns a PAR2 packet of the type with the body.
+func par2Packet(packetType string, body []byte) []byte {
+	packet := make([]byte, par2HeaderLength, par2HeaderLength+len(body))
+	copy(packet, par2Magic)
+	binary.LittleEndian.PutUint64(packet[8:16], uint64(par2HeaderLength+len(body)))
+	copy(packet[48:64], packetType)
+	packet = append(packet, body...)
+	hash := md5.Sum(packet[32:])
+	copy(packet[16:32], hash[:])
+	return packet
+}
+
+// par2FileDescPacket returns the file description packet of f.
+func par2FileDescPacket(f Par2File) []byte {
+	body := make([]byte, 56)
+	copy(body[0:16], f.ID[:])
+	copy(body[16:32], f.Hash[:])
+	copy(body[32:48], f.Hash16k[:])
+	binary.LittleEndian.PutUint64(body[48:56], uint64(f.Size))
+	name := []byte(f.Name)
+	for len(name)%4 != 0 {
+		name = append(name, 0)
+	}
+	return par2Packet(par2FileDesc, append(body, name...))
+}
+
+func TestParsePar2(t *testing.T) {
+	files := []Par2File{
+		{ID: [16]byte{1}, Name: "release.part1.rar", Size: 1000, Hash: [16]byte{2}, Hash16k: [16]byte{3}},
+		{ID: [16]byte{4}, Name: "release.nfo", Size: 12, Hash: [16]byte{5}, Hash16k: [16]byte{6}},
+	}
+	var data []byte
+	data = append(data, "garbage"...)
+	data = append(data, par2Packet("PAR 2.0\x00Main\x00\x00\x00\x00", make([]byte, 12))...)
+	data = append(data, par2FileDescPacket(files[0])...)
+	damaged := par2FileDescPacket(Par2File{ID: [16]byte{7}, Name: "damaged.rar"})
+	damaged[len(damaged)-1] ^= 0xff
+	data = append(data, damaged...)
+	data = append(data, par2FileDescPacket(files[1])...)
+	// packets are repeated
+	data = append(data, par2FileDescPacket(files[0])...)
+	got, err := ParsePar2(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != files[1] || got[1] != files[0] {
+		t.Errorf("ParsePar2 returned %+v, want %+v", got, []Par2File{files[1], files[0]})
+	}
+
+	truncated := par2FileDescPacket(files[0])
+	if files, err := ParsePar2(truncated[:len(truncated)-4]); err == nil {
+		t.Errorf("ParsePar2 of truncated packet returned %+v, want error", files)
+	}
+	if files, err := ParsePar2(nil); err == nil {
+		t.Errorf("ParsePar2 of no data returned %+v, want error", files)
+	}
+}
+
+func FuzzParsePar2(f *testing.F) {
+	f.Add(par2FileDescPacket(Par2File{ID: [16]byte{1}, Name: "release.rar", Size: 1000}))
+	f.Add(par2Packet("PAR 2.0\x00Main\x00\x00\x00\x00", make([]byte, 12)))
+	f.Add([]byte(par2Magic + "\xff\xff\xff\xff\xff\xff\xff\xff"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		files, err := ParsePar2(data)
+		if err == nil && len(files) == 0 {
+			t.Error("ParsePar2 returned no files and no error")
+		}
+		for _, file := range files {
+			if !bytes.Contains(data, file.ID[:]) {
+				t.Errorf("file id %x not in data", file.ID)
+			}
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package searcher
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParsedSubject is the information parsed from the subject of a message.
+// FileNo and TotalFiles are 1 if the subject has no file counter, as the
+// post is then taken to be a single file.
+type ParsedSubject struct {
+	Header        string
+	Filename      string
+	Basefilename  string
+	FileNo        int
+	TotalFiles    int
+	SegmentNo     int
+	TotalSegments int
+	// Rule is the name of the parser or rule the subject was parsed with.
+	Rule string
+}
+
+// SubjectParser parses the subjects of the messages found by the search.
+type SubjectParser interface {
+	// ParseSubject parses the subject of a message posted to group. It
+	// returns an error if the subject is not understood.
+	ParseSubject(subject, group string) (*ParsedSubject, error)
+}
+
+// ParserChain is a SubjectParser trying its parsers in order. The subject is
+// parsed by the first parser understanding it.
+type ParserChain []SubjectParser
+
+// ParseSubject implements SubjectParser. If no parser understands the
+// subject, the error of the last parser is returned.
+func (c ParserChain) ParseSubject(subject, group string) (*ParsedSubject, error) {
+	err := errors.New("no subject parser given")
+	for _, parser := range c {
+		var parsed *ParsedSubject
+		if parsed, err = parser.ParseSubject(subject, group); err == nil {
+			return parsed, nil
+		}
+	}
+	return nil, err
+}
+
+// DefaultParser is the built-in SubjectParser understanding the most common
+// subject formats of file posts.
+var DefaultParser SubjectParser = defaultParser{}
+
+var (
+	// segmentPattern matches the segment number at the end of the subject
+	segmentPattern = regexp.MustCompile(`^(?P<reminder>.+)(?:[\[\(] *(?P<segmentNo>\d+) *(?:/|of|von) *(?P<totalSegments>\d+) *[\)\]])`)
+	// fileNoPattern matches the file number in the rest of the subject
+	fileNoPattern = regexp.MustCompile(`^(?P<header>.*?)?(?:(?:[\[\(]|File|Datei)? *(?P<segmentNo>\d+) *(?:/|of|von) *(?P<totalSegments>\d+) *[\)\]]?)(?P<reminder>.*)?`)
+	// quotedFilenamePattern matches a file name in double quotes
+	quotedFilenamePattern = regexp.MustCompile(`(?i)^(?P<header>.*?)?[- ]*"(?P<filename>(?P<basefilename>.*?)\.(?P<extension>(?:vol\d+\+\d+\.par2?|part\d+\.[^ "\.]*|[^ "\.]*\.\d+|[^ "\.]*))")`)
+	// filenamePattern matches a file name at the start of the rest of the
+	// subject
+	filenamePattern = regexp.MustCompile(`(?i)^(?P<filename>(?P<basefilename>.*?)\.(?P<extension>(?:vol\d+\+\d+\.par2?|part\d+\.[^ "\.]*|[^ "\.]*\.\d+|[^ "\.]*))(?:[" ]|$))`)
+)
+
+type defaultParser struct{}
+
+func (defaultParser) ParseSubject(subject, group string) (*ParsedSubject, error) {
+	var matches map[string]string
+	if matches = findNamedMatches(segmentPattern, subject); matches == nil {
+		return nil, errors.New("subject did not match")
+	}
+	parsed := &ParsedSubject{FileNo: 1, TotalFiles: 1, Rule: "default"}
+	parsed.SegmentNo, _ = strconv.Atoi(matches["segmentNo"])
+	parsed.TotalSegments, _ = strconv.Atoi(matches["totalSegments"])
+	reminder := matches["reminder"]
+	if matches := findNamedMatches(fileNoPattern, reminder); matches != nil {
+		parsed.FileNo, _ = strconv.Atoi(matches["segmentNo"])
+		parsed.TotalFiles, _ = strconv.Atoi(matches["totalSegments"])
+		parsed.Header = strings.Trim(matches["header"], " -")
+		reminder = matches["reminder"]
+	}
+	if matches := findNamedMatches(quotedFilenamePattern, reminder); matches != nil {
+		if matches["header"] != "" {
+			if parsed.Header == "" {
+				parsed.Header = strings.Trim(matches["header"], " -")
+			} else {
+				parsed.Header = parsed.Header + " " + strings.Trim(matches["header"], " -")
+			}
+		}
+		parsed.Filename = strings.Trim(matches["filename"], " -\"")
+		parsed.Basefilename = strings.Trim(matches["basefilename"], " -")
+	} else if matches := findNamedMatches(filenamePattern, reminder); matches != nil {
+		parsed.Filename = strings.Trim(matches["filename"], " -\"")
+		parsed.Basefilename = strings.Trim(matches["basefilename"], " -")
+	}
+	if parsed.Basefilename != "" {
+		if parsed.Header == "" {
+			parsed.Header = parsed.Basefilename
+		} else {
+			parsed.Header = parsed.Header + " - " + parsed.Basefilename
+		}
+	}
+	if parsed.Header == "" {
+		return nil, errors.New("no header found")
+	}
+	if parsed.Filename == "" {
+		return nil, errors.New("no filename found")
+	}
+	return parsed, nil
+}
+
+func findNamedMatches(regex *regexp.Regexp, str string) map[string]string {
+	match := regex.FindStringSubmatch(str)
+	if match == nil {
+		return nil
+	}
+	results := map[string]string{}
+	for i, name := range match {
+		results[regex.SubexpNames()[i]] = name
+	}
+	return results
+}
@@ -0,0 +1,234 @@
+package searcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestDefaultParser(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    *ParsedSubject
+		err     string
+	}{
+		{
+			subject: `My.Show.S01E01.720p [1/3] - "my.show.s01e01.part1.rar" yEnc (2/4)`,
+			want: &ParsedSubject{
+				Header:        "My.Show.S01E01.720p - my.show.s01e01",
+				Filename:      "my.show.s01e01.part1.rar",
+				Basefilename:  "my.show.s01e01",
+				FileNo:        1,
+				TotalFiles:    3,
+				SegmentNo:     2,
+				TotalSegments: 4,
+				Rule:          "default",
+			},
+		},
+		{
+			subject: `[15/15] - "release.vol31+32.par2" yEnc (1/33)`,
+			want: &ParsedSubject{
+				Header:        "release",
+				Filename:      "release.vol31+32.par2",
+				Basefilename:  "release",
+				FileNo:        15,
+				TotalFiles:    15,
+				SegmentNo:     1,
+				TotalSegments: 33,
+				Rule:          "default",
+			},
+		},
+		{
+			subject: `Title - File 2 of 5 - "title.nfo" (1/1)`,
+			want: &ParsedSubject{
+				Header:        "Title - title",
+				Filename:      "title.nfo",
+				Basefilename:  "title",
+				FileNo:        2,
+				TotalFiles:    5,
+				SegmentNo:     1,
+				TotalSegments: 1,
+				Rule:          "default",
+			},
+		},
+		{
+			subject: `"abc.mkv" yEnc (3/20)`,
+			want: &ParsedSubject{
+				Header:        "abc",
+				Filename:      "abc.mkv",
+				Basefilename:  "abc",
+				FileNo:        1,
+				TotalFiles:    1,
+				SegmentNo:     3,
+				TotalSegments: 20,
+				Rule:          "default",
+			},
+		},
+		{subject: "random post 1234", err: "subject did not match"},
+		{subject: "(1/1)", err: "subject did not match"},
+		{subject: "Some Title (1/5)", err: "no header found"},
+		{subject: "Title [1/2] - no file (1/3)", err: "no filename found"},
+	}
+	for _, test := range tests {
+		t.Run(test.subject, func(t *testing.T) {
+			got, err := DefaultParser.ParseSubject(test.subject, "alt.binaries.test")
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != *test.want {
+				t.Errorf("got %+v, want %+v", *got, *test.want)
+			}
+		})
+	}
+}
+
+// goldenSubject is the result of parsing a subject of the corpus.
+type goldenSubject struct {
+	Subject string
+	Parsed  *ParsedSubject `json:",omitempty"`
+	Error   string         `json:",omitempty"`
+}
+
+// readCorpus returns the subjects of the corpus of real-world subjects.
+func readCorpus(t testing.TB) []string {
+	f, err := os.Open(filepath.Join("testdata", "subjects.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var subjects []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" && !strings.HasPrefix(line, "#") {
+			subjects = append(subjects, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return subjects
+}
+
+func TestDefaultParserGolden(t *testing.T) {
+	var results []goldenSubject
+	for _, subject := range readCorpus(t) {
+		result := goldenSubject{Subject: subject}
+		parsed, err := DefaultParser.ParseSubject(subject, "alt.binaries.test")
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Parsed = parsed
+		}
+		results = append(results, result)
+	}
+	got, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	golden := filepath.Join("testdata", "subjects.golden")
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	var wantResults []goldenSubject
+	if err := json.Unmarshal(want, &wantResults); err != nil {
+		t.Fatalf("error reading %s: %v", golden, err)
+	}
+	wanted := make(map[string]goldenSubject, len(wantResults))
+	for _, result := range wantResults {
+		wanted[result.Subject] = result
+	}
+	for _, result := range results {
+		gotJSON, _ := json.Marshal(result)
+		wantJSON, _ := json.Marshal(wanted[result.Subject])
+		if !bytes.Equal(gotJSON, wantJSON) {
+			t.Errorf("subject %q:\ngot  %s\nwant %s", result.Subject, gotJSON, wantJSON)
+		}
+	}
+	if len(results) != len(wantResults) {
+		t.Errorf("got %d subjects, %s has %d, run the test with -update", len(results), golden, len(wantResults))
+	}
+}
+
+func TestParserChain(t *testing.T) {
+	rules, err := ParseSubjectRules([]byte(`
+rules:
+  - name: plain
+    pattern: '^(?P<filename>\S+\.bin)$'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := ParserChain{rules, DefaultParser}
+	tests := []struct {
+		subject string
+		rule    string
+		err     string
+	}{
+		{subject: "data.bin", rule: "plain"},
+		{subject: `"data.rar" yEnc (1/2)`, rule: "default"},
+		{subject: "random post", err: "subject did not match"},
+	}
+	for _, test := range tests {
+		parsed, err := chain.ParseSubject(test.subject, "alt.binaries.test")
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: got error %v, want %q", test.subject, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.subject, err)
+			continue
+		}
+		if parsed.Rule != test.rule {
+			t.Errorf("%q: parsed with rule %q, want %q", test.subject, parsed.Rule, test.rule)
+		}
+	}
+	if _, err := (ParserChain{}).ParseSubject("data.bin", ""); err == nil {
+		t.Error("empty chain parsed subject")
+	}
+}
+
+func FuzzDefaultParser(f *testing.F) {
+	for _, subject := range readCorpus(f) {
+		f.Add(subject)
+	}
+	f.Fuzz(func(t *testing.T, subject string) {
+		parsed, err := DefaultParser.ParseSubject(subject, "alt.binaries.test")
+		if err != nil {
+			return
+		}
+		if parsed.Header == "" {
+			t.Errorf("%q: empty header", subject)
+		}
+		if parsed.Filename == "" || !strings.Contains(subject, parsed.Filename) {
+			t.Errorf("%q: filename %q not in subject", subject, parsed.Filename)
+		}
+		if parsed.SegmentNo < 0 || parsed.TotalSegments < 0 || parsed.FileNo < 0 || parsed.TotalFiles < 0 {
+			t.Errorf("%q: negative numbers in %+v", subject, *parsed)
+		}
+	})
+}
@@ -0,0 +1,437 @@
+package searcher
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Query is a compiled search query for the subjects of the messages.
+//
+// A query consists of terms combined with the operators AND, OR and NOT
+// (in upper case) and grouped with parentheses. Terms next to each other
+// without an operator are combined with AND, a term prefixed with "-" is
+// negated. A term is one of
+//   - a word, matched case insensitively anywhere in the subject, in which
+//     "*" matches any number of characters and "?" matches one character
+//   - a phrase in double quotes, matched case insensitively as a whole
+//   - a regular expression prefixed with "re:", e.g. re:S\d\dE\d\d or
+//     re:"720p|1080p" if it contains spaces
+//
+// Example: show.name AND (720p OR 1080p) NOT sample
+type Query struct {
+	source string
+	root   queryNode
+	terms  *termTable
+}
+
+// termTable holds the distinct terms of one or more queries, so every term
+// is matched only once per subject even if it is used in several queries.
+type termTable struct {
+	patterns []*regexp.Regexp
+	ids      map[string]int
+}
+
+func newTermTable() *termTable {
+	return &termTable{ids: make(map[string]int)}
+}
+
+// add returns the id of pattern, adding it to the table if necessary.
+func (t *termTable) add(pattern *regexp.Regexp) int {
+	if id, ok := t.ids[pattern.String()]; ok {
+		return id
+	}
+	t.patterns = append(t.patterns, pattern)
+	t.ids[pattern.String()] = len(t.patterns) - 1
+	return len(t.patterns) - 1
+}
+
+// evaluation matches the terms of a term table against a subject, each term
+// at most once.
+type evaluation struct {
+	subject string
+	terms   *termTable
+	// results holds 0 for the terms not matched yet, 1 for the matching
+	// and -1 for the non-matching terms.
+	results []int8
+}
+
+func (t *termTable) evaluate(subject string) *evaluation {
+	return &evaluation{subject: subject, terms: t, results: make([]int8, len(t.patterns))}
+}
+
+func (e *evaluation) term(id int) bool {
+	if e.results[id] == 0 {
+		e.results[id] = -1
+		if e.terms.patterns[id].MatchString(e.subject) {
+			e.results[id] = 1
+		}
+	}
+	return e.results[id] == 1
+}
+
+type queryNode interface {
+	match(e *evaluation) bool
+}
+
+type termNode struct{ id int }
+type notNode struct{ node queryNode }
+type andNode struct{ nodes []queryNode }
+type orNode struct{ nodes []queryNode }
+
+func (n termNode) match(e *evaluation) bool { return e.term(n.id) }
+func (n notNode) match(e *evaluation) bool  { return !n.node.match(e) }
+
+func (n andNode) match(e *evaluation) bool {
+	for _, node := range n.nodes {
+		if !node.match(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n orNode) match(e *evaluation) bool {
+	for _, node := range n.nodes {
+		if node.match(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseQuery compiles the search query source.
+func ParseQuery(source string) (*Query, error) {
+	return parseQuery(source, newTermTable())
+}
+
+func parseQuery(source string, terms *termTable) (*Query, error) {
+	tokens, err := lexQuery(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens, terms: terms}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected '%s' in query", p.peek().text)
+	}
+	return &Query{source: source, root: root, terms: terms}, nil
+}
+
+// LiteralQuery returns a query matching subjects containing text, ignoring
+// case.
+func LiteralQuery(text string) *Query {
+	return literalQuery(text, newTermTable())
+}
+
+func literalQuery(text string, terms *termTable) *Query {
+	id := terms.add(regexp.MustCompile("(?i)" + regexp.QuoteMeta(text)))
+	return &Query{source: text, root: termNode{id}, terms: terms}
+}
+
+// Match reports whether subject matches the query.
+func (q *Query) Match(subject string) bool {
+	return q.root.match(q.terms.evaluate(subject))
+}
+
+func (q *Query) String() string {
+	return q.source
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenTerm
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind    tokenKind
+	text    string
+	pattern *regexp.Regexp
+}
+
+func lexQuery(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")"})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, token{kind: tokenNot, text: "-"})
+			i++
+		case r == '"':
+			phrase, next, err := readQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			if phrase == "" {
+				return nil, errors.New("empty phrase in query")
+			}
+			tokens = append(tokens, token{kind: tokenTerm, text: phrase, pattern: regexp.MustCompile("(?i)" + regexp.QuoteMeta(phrase))})
+			i = next
+		case strings.HasPrefix(string(runes[i:]), "re:"):
+			var expr string
+			next := i + 3
+			if next < len(runes) && runes[next] == '"' {
+				var err error
+				if expr, next, err = readQuoted(runes, next); err != nil {
+					return nil, err
+				}
+			} else {
+				expr, next = readRegexp(runes, next)
+			}
+			pattern, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression '%s' in query: %w", expr, err)
+			}
+			tokens = append(tokens, token{kind: tokenTerm, text: "re:" + expr, pattern: pattern})
+			i = next
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			word := string(runes[start:i])
+			switch word {
+			case "AND":
+				tokens = append(tokens, token{kind: tokenAnd, text: word})
+			case "OR":
+				tokens = append(tokens, token{kind: tokenOr, text: word})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokenNot, text: word})
+			default:
+				tokens = append(tokens, token{kind: tokenTerm, text: word, pattern: wildcardPattern(word)})
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// readQuoted reads the text in double quotes starting at runes[start].
+// A double quote within the text is escaped with a backslash.
+func readQuoted(runes []rune, start int) (string, int, error) {
+	var text strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == '"':
+			text.WriteRune('"')
+			i++
+		case runes[i] == '"':
+			return text.String(), i + 1, nil
+		default:
+			text.WriteRune(runes[i])
+		}
+	}
+	return "", 0, errors.New("missing closing quote in query")
+}
+
+// readRegexp reads an unquoted regular expression up to the next space or
+// the next unbalanced closing parenthesis.
+func readRegexp(runes []rune, start int) (string, int) {
+	depth := 0
+	i := start
+	for ; i < len(runes) && !unicode.IsSpace(runes[i]); i++ {
+		if runes[i] == '\\' {
+			i++
+			continue
+		}
+		if runes[i] == '(' {
+			depth++
+		} else if runes[i] == ')' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+	}
+	if i > len(runes) {
+		i = len(runes)
+	}
+	return string(runes[start:i]), i
+}
+
+// wildcardPattern returns the case insensitive pattern for word with "*"
+// matching any number of characters and "?" matching one character.
+func wildcardPattern(word string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("(?i)")
+	for _, r := range word {
+		switch r {
+		case '*':
+			pattern.WriteString(".*?")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return regexp.MustCompile(pattern.String())
+}
+
+type queryParser struct {
+	tokens []token
+	pos    int
+	terms  *termTable
+}
+
+func (p *queryParser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{kind: tokenEnd}
+}
+
+func (p *queryParser) next() token {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []queryNode{node}
+	for p.peek().kind == tokenOr {
+		p.next()
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return orNode{nodes}, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	node, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []queryNode{node}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.next()
+		case tokenTerm, tokenNot, tokenOpen:
+			// terms next to each other are combined with AND
+		default:
+			if len(nodes) == 1 {
+				return nodes[0], nil
+			}
+			return andNode{nodes}, nil
+		}
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenTerm:
+		return termNode{p.terms.add(t.pattern)}, nil
+	case tokenOpen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenClose {
+			return nil, errors.New("missing closing parenthesis in query")
+		}
+		return node, nil
+	case tokenEnd:
+		return nil, errors.New("unexpected end of query")
+	default:
+		return nil, fmt.Errorf("unexpected '%s' in query", t.text)
+	}
+}
+
+// querySet is a set of queries matched against a subject at once.
+type querySet struct {
+	queries []*Query
+	terms   *termTable
+}
+
+// queryMarker matches the operators AND, OR and NOT, double quotes and
+// regular expressions, which make a header a query.
+var queryMarker = regexp.MustCompile(`(?:^|[\s(])(?:AND|OR|NOT)(?:$|[\s(])|"|(?:^|[\s(-])re:`)
+
+// isQuery reports whether header is a query. Headers without operators,
+// double quotes or regular expressions are searched for literally, like
+// before queries were introduced.
+func isQuery(header string) bool {
+	return queryMarker.MatchString(header)
+}
+
+// newQuerySet compiles the queries in sources. A source that is not a query
+// or not a valid query is searched for literally, the error of an invalid
+// query is passed to invalid.
+func newQuerySet(sources []string, invalid func(source string, err error)) *querySet {
+	set := &querySet{terms: newTermTable()}
+	for _, source := range sources {
+		if !isQuery(source) {
+			set.queries = append(set.queries, literalQuery(source, set.terms))
+			continue
+		}
+		query, err := parseQuery(source, set.terms)
+		if err != nil {
+			invalid(source, err)
+			query = literalQuery(source, set.terms)
+		}
+		set.queries = append(set.queries, query)
+	}
+	return set
+}
+
+// match returns the queries matching subject.
+func (set *querySet) match(subject string) []*Query {
+	var matching []*Query
+	e := set.terms.evaluate(subject)
+	for _, query := range set.queries {
+		if query.root.match(e) {
+			matching = append(matching, query)
+		}
+	}
+	return matching
+}
@@ -0,0 +1,135 @@
+package searcher
+
+import "testing"
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		subject string
+		want    bool
+	}{
+		// words and phrases
+		{query: "show.name", subject: `Show.Name.S01E01 [1/3] - "a.rar" yEnc (1/2)`, want: true},
+		{query: "show.name", subject: "Show Name S01E01", want: false},
+		{query: `"show name"`, subject: "The Show Name S01E01", want: true},
+		{query: `"show name"`, subject: "Show The Name", want: false},
+		{query: `"say \"hi\""`, subject: `they say "hi"`, want: true},
+		// implicit AND and precedence of AND over OR
+		{query: "show 720p", subject: "Show 720p", want: true},
+		{query: "show 720p", subject: "Show 1080p", want: false},
+		{query: "show AND 720p OR 1080p", subject: "Other 1080p", want: true},
+		{query: "show AND (720p OR 1080p)", subject: "Other 1080p", want: false},
+		{query: "show AND (720p OR 1080p)", subject: "Show 1080p", want: true},
+		{query: "a OR b c", subject: "b", want: false},
+		{query: "a OR b c", subject: "a", want: true},
+		// negation
+		{query: "show -sample", subject: "Show sample", want: false},
+		{query: "show -sample", subject: "Show", want: true},
+		{query: "show NOT sample", subject: "Show sample", want: false},
+		{query: "NOT NOT show", subject: "Show", want: true},
+		{query: "show -(sample OR proof)", subject: "Show proof", want: false},
+		{query: "show - 720p", subject: "Show - 720p", want: true},
+		{query: "show-name", subject: "Show-Name", want: true},
+		// regular expressions
+		{query: `re:S\d\dE\d\d`, subject: "Show S01E02", want: true},
+		{query: `re:S\d\dE\d\d`, subject: "Show Season 1", want: false},
+		{query: `re:"720p|1080p" show`, subject: "Show 1080p", want: true},
+		{query: `(re:(a|b)c)`, subject: "bc", want: true},
+		{query: `re:"a b"`, subject: "A B", want: true},
+		// wildcards
+		{query: "show*720p", subject: "Show.S01E01.720p", want: true},
+		{query: "s0?e01", subject: "Show.S01E01", want: true},
+		{query: "s0?e01", subject: "Show.S0E01", want: false},
+		{query: "a+b", subject: "A+B", want: true},
+		{query: "a+b", subject: "aab", want: false},
+	}
+	for _, test := range tests {
+		query, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", test.query, err)
+			continue
+		}
+		if got := query.Match(test.subject); got != test.want {
+			t.Errorf("query %q matching %q = %v, want %v", test.query, test.subject, got, test.want)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"Movie (2020",
+		"show)",
+		`"unterminated`,
+		`""`,
+		"show AND",
+		"OR show",
+		"NOT",
+		"re:(",
+		"()",
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded, want error", query)
+		}
+	}
+}
+
+func TestQuerySet(t *testing.T) {
+	var invalid []string
+	set := newQuerySet([]string{"show AND 720p", "Movie AND (2020", "720p", "Some Show 2020", "-=Release=-", "a?c", "show*720p OR x"}, func(source string, err error) {
+		invalid = append(invalid, source)
+	})
+	if len(invalid) != 1 || invalid[0] != "Movie AND (2020" {
+		t.Errorf("invalid queries %q, want %q", invalid, "Movie AND (2020")
+	}
+	tests := []struct {
+		subject string
+		want    []string
+	}{
+		{subject: "Show 720p", want: []string{"show AND 720p", "720p", "show*720p OR x"}},
+		// the invalid query is searched for literally
+		{subject: "movie and (2020) 720p", want: []string{"Movie AND (2020", "720p"}},
+		{subject: "Movie 2020", want: nil},
+		// headers without operators, quotes or regular expressions are
+		// searched for literally
+		{subject: "some show 2020 [1/3]", want: []string{"Some Show 2020"}},
+		{subject: "Some 2020 Show", want: nil},
+		{subject: "-=Release=- [1/3]", want: []string{"-=Release=-"}},
+		{subject: "Other Release", want: nil},
+		{subject: "a?c", want: []string{"a?c"}},
+		{subject: "abc", want: nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, query := range set.match(test.subject) {
+			got = append(got, query.String())
+		}
+		if !equalStrings(got, test.want) {
+			t.Errorf("queries matching %q: %q, want %q", test.subject, got, test.want)
+		}
+	}
+}
+
+func TestIsQuery(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "Some Show 2020", want: false},
+		{header: "-=Release=-", want: false},
+		{header: "show*720p s0?e01", want: false},
+		{header: "Movie (2020)", want: false},
+		{header: "ANDROID OR-ORIGINAL NOTES", want: false},
+		{header: "show AND 720p", want: true},
+		{header: "show OR(720p)", want: true},
+		{header: "NOT sample", want: true},
+		{header: `"show name" 720p`, want: true},
+		{header: `re:S\d\dE\d\d`, want: true},
+		{header: `show -re:sample`, want: true},
+		{header: `genre:drama`, want: false},
+	}
+	for _, test := range tests {
+		if got := isQuery(test.header); got != test.want {
+			t.Errorf("isQuery(%q) = %v, want %v", test.header, got, test.want)
+		}
+	}
+}
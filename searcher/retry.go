@@ -0,0 +1,139 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/Tensai75/nntp"
+)
+
+// default retry settings used if not set in the options
+const (
+	defaultRetryDelay    = time.Second
+	defaultMaxRetryDelay = 30 * time.Second
+)
+
+// NNTP response codes with a special meaning for the retry handling
+const (
+	codeNoSuchGroup       = 411
+	codeNoGroupSelected   = 412
+	codeNoArticlesInRange = 423
+	codeNoSuchArticle     = 430
+	codeAuthRequired      = 480
+	codeAuthRejected      = 481
+	codeAuthOutOfSequence = 482
+)
+
+// Range is a range of article numbers, both inclusive.
+type Range struct {
+	First int
+	Last  int
+}
+
+func (r Range) String() string {
+	if r.First == r.Last {
+		return fmt.Sprintf("%d", r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// formatRanges returns the ranges as a comma separated list.
+func formatRanges(ranges []Range) string {
+	list := make([]string, len(ranges))
+	for i, r := range ranges {
+		list[i] = r.String()
+	}
+	return strings.Join(list, ", ")
+}
+
+// isRetryable reports whether a request that failed with err may succeed
+// if it is repeated. Connection errors and temporary NNTP errors (4xx) are
+// retryable, permanent NNTP errors (5xx), missing groups or articles and
+// authentication errors are not.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var nntpErr nntp.Error
+	if errors.As(err, &nntpErr) {
+		switch nntpErr.Code {
+		case codeNoSuchGroup, codeNoGroupSelected, codeNoArticlesInRange, codeNoSuchArticle,
+			codeAuthRequired, codeAuthRejected, codeAuthOutOfSequence:
+			return false
+		}
+		return nntpErr.Code/100 == 4
+	}
+	return isConnectionError(err)
+}
+
+// isNoArticles reports whether err is the response of the server to an
+// overview request for a range without any articles.
+func isNoArticles(err error) bool {
+	var nntpErr nntp.Error
+	return errors.As(err, &nntpErr) && nntpErr.Code == codeNoArticlesInRange
+}
+
+// isNoSuchArticle reports whether err is the response of the server to a
+// request for an article it does not have.
+func isNoSuchArticle(err error) bool {
+	var nntpErr nntp.Error
+	return errors.As(err, &nntpErr) && nntpErr.Code == codeNoSuchArticle
+}
+
+// backoff returns the delay before retry number attempt (starting at 1),
+// growing exponentially with full jitter.
+func (s *Searcher) backoff(attempt int) time.Duration {
+	delay := s.opts.RetryDelay
+	for i := 1; i < attempt && delay < s.opts.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.opts.MaxRetryDelay {
+		delay = s.opts.MaxRetryDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// withRetry calls request until it succeeds, fails with an error that is
+// not retryable, the maximum number of retries is reached or ctx is done.
+func (s *Searcher) withRetry(ctx context.Context, description string, request func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = request(); err == nil || !isRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= s.opts.Retries {
+			return err
+		}
+		delay := s.backoff(attempt + 1)
+		s.debugf("Error %s (retry %d of %d in %v): %v\n", description, attempt+1, s.opts.Retries, delay.Round(time.Millisecond), err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Searcher) addFailedRange(group string, r Range) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failedRanges[group] = append(s.failedRanges[group], r)
+}
+
+// FailedRanges returns the article ranges per group that could not be
+// retrieved from the server after all retries.
+func (s *Searcher) FailedRanges() map[string][]Range {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	failedRanges := make(map[string][]Range, len(s.failedRanges))
+	for group, ranges := range s.failedRanges {
+		failedRanges[group] = append([]Range(nil), ranges...)
+	}
+	return failedRanges
+}
@@ -0,0 +1,186 @@
+package searcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ruleFields are the named groups a subject rule can set.
+var ruleFields = map[string]bool{
+	"header":        true,
+	"filename":      true,
+	"basefilename":  true,
+	"fileNo":        true,
+	"totalFiles":    true,
+	"segmentNo":     true,
+	"totalSegments": true,
+}
+
+// SubjectRule is a rule parsing subjects with a regular expression. The
+// named groups of the expression set the fields of the subject parsed:
+// header, filename, basefilename, fileNo, totalFiles, segmentNo and
+// totalSegments. Only filename is required. Without header the base name
+// of the file is used as header and without segmentNo and totalSegments the
+// message is taken as the only segment of the file.
+type SubjectRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+
+	regexp *regexp.Regexp
+}
+
+// SubjectRules is a SubjectParser parsing subjects with user defined rules.
+type SubjectRules struct {
+	// Rules are tried in order for the subjects of all groups.
+	Rules []SubjectRule `yaml:"rules"`
+	// Groups are the rules for single groups. They are tried before Rules
+	// and replace the rules of Rules with the same name.
+	Groups map[string][]SubjectRule `yaml:"groups"`
+
+	rulesByGroup map[string][]*SubjectRule
+}
+
+// LoadSubjectRules loads the subject rules from the YAML file path.
+func LoadSubjectRules(path string) (*SubjectRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseSubjectRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("error in subject rules file '%s': %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseSubjectRules parses subject rules in YAML, e.g.
+//
+//	rules:
+//	  - name: bracketed
+//	    pattern: '^\[(?P<fileNo>\d+)/(?P<totalFiles>\d+)\] - "(?P<filename>[^"]+)" yEnc \((?P<segmentNo>\d+)/(?P<totalSegments>\d+)\)'
+//	groups:
+//	  alt.binaries.example:
+//	    - name: bracketed
+//	      pattern: ...
+func ParseSubjectRules(data []byte) (*SubjectRules, error) {
+	rules := &SubjectRules{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(rules); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := compileRules(rules.Rules, "rule"); err != nil {
+		return nil, err
+	}
+	rules.rulesByGroup = make(map[string][]*SubjectRule, len(rules.Groups))
+	for group, groupRules := range rules.Groups {
+		if err := compileRules(groupRules, group+" rule"); err != nil {
+			return nil, err
+		}
+		replaced := make(map[string]bool, len(groupRules))
+		for i := range groupRules {
+			rules.rulesByGroup[group] = append(rules.rulesByGroup[group], &groupRules[i])
+			replaced[groupRules[i].Name] = true
+		}
+		for i := range rules.Rules {
+			if !replaced[rules.Rules[i].Name] {
+				rules.rulesByGroup[group] = append(rules.rulesByGroup[group], &rules.Rules[i])
+			}
+		}
+	}
+	return rules, nil
+}
+
+// compileRules compiles the patterns of rules and names the rules without
+// a name by prefix and their position.
+func compileRules(rules []SubjectRule, prefix string) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("%s %d", prefix, i+1)
+		}
+		var err error
+		if rule.regexp, err = regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern of rule '%s': %w", rule.Name, err)
+		}
+		hasFilename := false
+		for _, name := range rule.regexp.SubexpNames() {
+			if name != "" && !ruleFields[name] {
+				return fmt.Errorf("unknown field '%s' in pattern of rule '%s'", name, rule.Name)
+			}
+			hasFilename = hasFilename || name == "filename"
+		}
+		if !hasFilename {
+			return fmt.Errorf("pattern of rule '%s' has no filename", rule.Name)
+		}
+	}
+	return nil
+}
+
+// ParseSubject implements SubjectParser.
+func (r *SubjectRules) ParseSubject(subject, group string) (*ParsedSubject, error) {
+	rules, ok := r.rulesByGroup[group]
+	if !ok {
+		rules = make([]*SubjectRule, len(r.Rules))
+		for i := range r.Rules {
+			rules[i] = &r.Rules[i]
+		}
+	}
+	for _, rule := range rules {
+		if parsed := rule.parse(subject); parsed != nil {
+			return parsed, nil
+		}
+	}
+	return nil, errors.New("subject did not match any rule")
+}
+
+// parse returns the subject parsed with the rule or nil if the subject does
+// not match or no file name is found.
+func (rule *SubjectRule) parse(subject string) *ParsedSubject {
+	matches := findNamedMatches(rule.regexp, subject)
+	if matches == nil {
+		return nil
+	}
+	parsed := &ParsedSubject{
+		Header:       strings.Trim(matches["header"], " -"),
+		Filename:     strings.Trim(matches["filename"], " -\""),
+		Basefilename: strings.Trim(matches["basefilename"], " -"),
+		Rule:         rule.Name,
+	}
+	if parsed.Filename == "" {
+		return nil
+	}
+	parsed.FileNo, _ = strconv.Atoi(matches["fileNo"])
+	parsed.TotalFiles, _ = strconv.Atoi(matches["totalFiles"])
+	if parsed.FileNo == 0 && parsed.TotalFiles == 0 {
+		parsed.FileNo, parsed.TotalFiles = 1, 1
+	}
+	parsed.SegmentNo, _ = strconv.Atoi(matches["segmentNo"])
+	parsed.TotalSegments, _ = strconv.Atoi(matches["totalSegments"])
+	if parsed.SegmentNo == 0 && parsed.TotalSegments == 0 {
+		parsed.SegmentNo, parsed.TotalSegments = 1, 1
+	}
+	if parsed.Basefilename == "" {
+		if matches := findNamedMatches(filenamePattern, parsed.Filename); matches != nil {
+			parsed.Basefilename = strings.Trim(matches["basefilename"], " -")
+		} else {
+			parsed.Basefilename = strings.TrimSuffix(parsed.Filename, path.Ext(parsed.Filename))
+		}
+	}
+	if parsed.Header == "" {
+		parsed.Header = parsed.Basefilename
+	}
+	if parsed.Header == "" {
+		parsed.Header = parsed.Filename
+	}
+	return parsed
+}
@@ -0,0 +1,171 @@
+package searcher
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRules = `
+rules:
+  - name: bracketed
+    pattern: '^\[(?P<fileNo>\d+)/(?P<totalFiles>\d+)\] - "(?P<filename>[^"]+)" yEnc \((?P<segmentNo>\d+)/(?P<totalSegments>\d+)\)'
+  - pattern: '^(?P<header>.+?) :: (?P<filename>\S+)$'
+groups:
+  alt.binaries.other:
+    - name: bracketed
+      pattern: '^\[(?P<fileNo>\d+)/(?P<totalFiles>\d+)\] (?P<header>\S+) "(?P<filename>[^"]+)"'
+    - name: numbered
+      pattern: '^(?P<filename>\S+) (?P<segmentNo>\d+)/(?P<totalSegments>\d+)$'
+`
+
+func TestSubjectRules(t *testing.T) {
+	rules, err := ParseSubjectRules([]byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		subject string
+		group   string
+		want    *ParsedSubject
+	}{
+		{
+			subject: `[2/5] - "q8z1x7.part2.rar" yEnc (3/40)`,
+			group:   "alt.binaries.test",
+			want: &ParsedSubject{
+				Header:        "q8z1x7",
+				Filename:      "q8z1x7.part2.rar",
+				Basefilename:  "q8z1x7",
+				FileNo:        2,
+				TotalFiles:    5,
+				SegmentNo:     3,
+				TotalSegments: 40,
+				Rule:          "bracketed",
+			},
+		},
+		{
+			subject: "My Post :: post.tar.gz",
+			group:   "alt.binaries.test",
+			want: &ParsedSubject{
+				Header:        "My Post",
+				Filename:      "post.tar.gz",
+				Basefilename:  "post.tar",
+				FileNo:        1,
+				TotalFiles:    1,
+				SegmentNo:     1,
+				TotalSegments: 1,
+				Rule:          "rule 2",
+			},
+		},
+		{
+			// the group rule replaces the rule with the same name
+			subject: `[1/2] Title "title.mkv"`,
+			group:   "alt.binaries.other",
+			want: &ParsedSubject{
+				Header:        "Title",
+				Filename:      "title.mkv",
+				Basefilename:  "title",
+				FileNo:        1,
+				TotalFiles:    2,
+				SegmentNo:     1,
+				TotalSegments: 1,
+				Rule:          "bracketed",
+			},
+		},
+		{
+			subject: "data.bin 7/9",
+			group:   "alt.binaries.other",
+			want: &ParsedSubject{
+				Header:        "data",
+				Filename:      "data.bin",
+				Basefilename:  "data",
+				FileNo:        1,
+				TotalFiles:    1,
+				SegmentNo:     7,
+				TotalSegments: 9,
+				Rule:          "numbered",
+			},
+		},
+		{
+			// the other rules still apply in the group
+			subject: "My Post :: post.nfo",
+			group:   "alt.binaries.other",
+			want: &ParsedSubject{
+				Header:        "My Post",
+				Filename:      "post.nfo",
+				Basefilename:  "post",
+				FileNo:        1,
+				TotalFiles:    1,
+				SegmentNo:     1,
+				TotalSegments: 1,
+				Rule:          "rule 2",
+			},
+		},
+		{subject: `[1/2] Title "title.mkv"`, group: "alt.binaries.test"},
+		{subject: "data.bin 7/9", group: "alt.binaries.test"},
+		{subject: "random post 1234", group: "alt.binaries.other"},
+	}
+	for _, test := range tests {
+		got, err := rules.ParseSubject(test.subject, test.group)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%q in %s: parsed with rule %q, want no match", test.subject, test.group, got.Rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q in %s: unexpected error: %v", test.subject, test.group, err)
+			continue
+		}
+		if *got != *test.want {
+			t.Errorf("%q in %s:\ngot  %+v\nwant %+v", test.subject, test.group, *got, *test.want)
+		}
+	}
+}
+
+func TestParseSubjectRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		err   string
+	}{
+		{"unknown key", "rule: []", "field rule not found"},
+		{"invalid pattern", "rules: [{name: broken, pattern: '(?P<filename>'}]", "invalid pattern of rule 'broken'"},
+		{"unknown field", "rules: [{pattern: '(?P<size>\\d+) (?P<filename>\\S+)'}]", "unknown field 'size' in pattern of rule 'rule 1'"},
+		{"no filename", "rules: [{pattern: '(?P<header>.+)'}]", "pattern of rule 'rule 1' has no filename"},
+		{"group rule", "groups: {a.b.test: [{pattern: '.+'}]}", "pattern of rule 'a.b.test rule 1' has no filename"},
+	}
+	for _, test := range tests {
+		_, err := ParseSubjectRules([]byte(test.rules))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+	if rules, err := ParseSubjectRules(nil); err != nil {
+		t.Errorf("empty rules: unexpected error: %v", err)
+	} else if _, err := rules.ParseSubject("data.bin", ""); err == nil {
+		t.Error("empty rules parsed subject")
+	}
+}
+
+func FuzzSubjectRules(f *testing.F) {
+	rules, err := ParseSubjectRules([]byte(testRules))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, subject := range readCorpus(f) {
+		f.Add(subject, "alt.binaries.test")
+	}
+	f.Add("data.bin 7/9", "alt.binaries.other")
+	f.Fuzz(func(t *testing.T, subject, group string) {
+		parsed, err := rules.ParseSubject(subject, group)
+		if err != nil {
+			return
+		}
+		if parsed.Header == "" || parsed.Filename == "" {
+			t.Errorf("%q: empty header or filename in %+v", subject, *parsed)
+		}
+		if parsed.SegmentNo < 0 || parsed.TotalSegments < 0 || parsed.FileNo < 0 || parsed.TotalFiles < 0 {
+			t.Errorf("%q: negative numbers in %+v", subject, *parsed)
+		}
+	})
+}
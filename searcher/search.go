@@ -0,0 +1,349 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Tensai75/nntp"
+)
+
+// Search searches group for the header and returns the headers found.
+// If ctx is done before the search has finished, the headers found so far
+// are returned together with the error of ctx. If the search in group was
+// started by an earlier search resumed, only the messages not searched yet
+// are searched.
+func (s *Searcher) Search(ctx context.Context, group string) ([]*Header, error) {
+	if s.opts.To.IsZero() {
+		return nil, errors.New("no date range to search given")
+	}
+	selected, completed, finished, err := s.resumeRange(group)
+	if err != nil {
+		return nil, err
+	}
+	if finished {
+		s.setGroupPool(group, selected.pool)
+		s.logf("Search in group '%s' already finished\n", group)
+		return s.results(group), nil
+	}
+	if selected == nil {
+		if selected, err = s.selectServer(ctx, group); err != nil {
+			return nil, err
+		}
+		s.startGroupState(group, selected)
+	}
+	s.setGroupPool(group, selected.pool)
+	if len(s.pools) > 1 {
+		s.logf("Using server %s for group '%s'\n", selected.pool.server, group)
+	}
+	currentMessageID, currentMessageDate := selected.firstMessageID, selected.firstDate
+	lastMessageID, lastMessageDate := selected.lastMessageID, selected.lastDate
+	s.debugf("First message in group '%s' to start the search is %d, uploaded on %s\n", group, currentMessageID, currentMessageDate)
+	if currentMessageID >= lastMessageID {
+		return nil, errors.New("no messages found within search range")
+	}
+	startMessageID := currentMessageID
+	s.logf("Start searching messages %d to %d from %s to %s in group '%s'\n", startMessageID, lastMessageID, currentMessageDate, lastMessageDate, group)
+	if len(completed) > 0 {
+		s.logf("Resuming search in group '%s', skipping messages already searched: %s\n", group, formatRanges(completed))
+	}
+	var wg sync.WaitGroup
+	for currentMessageID <= lastMessageID && ctx.Err() == nil {
+		lastMessage := int(math.Min(float64(currentMessageID+s.opts.Step), float64(lastMessageID)))
+		for _, r := range missingRanges(Range{First: currentMessageID, Last: lastMessage}, completed) {
+			wg.Add(1)
+			go func(r Range) {
+				defer wg.Done()
+				s.SearchMessages(ctx, r.First, r.Last, group)
+			}(r)
+		}
+		// update currentMessageID for next request
+		currentMessageID = lastMessage + 1
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		s.logf("Search in group '%s' was interrupted\n", group)
+		return s.results(group), ctx.Err()
+	}
+	if len(s.FailedRanges()[group]) == 0 {
+		s.finishGroupState(group)
+	}
+	s.logf("Finished searching in group '%s'\n", group)
+	s.debugf("Messages %d to %d were searched in group '%s'\n", startMessageID, currentMessageID-1, group)
+	return s.results(group), nil
+}
+
+// selectServer scans group on the servers in order of their priority and
+// returns the search range on the first server carrying the group and
+// covering the whole search range. If no server covers the whole range, the
+// one reaching back furthest is used. If an index is used and covers the
+// whole search range of a server, the range is taken from the index.
+func (s *Searcher) selectServer(ctx context.Context, group string) (*searchRange, error) {
+	for _, p := range s.pools {
+		r, err := s.indexedRange(p, group)
+		if err != nil {
+			s.logf("Error reading the index of group '%s' on server %s: %v\n", group, p.server, err)
+			continue
+		}
+		if r != nil {
+			s.logf("Taking the search range in group '%s' on server %s from the index\n", group, p.server)
+			return r, nil
+		}
+	}
+	s.logf("Switching to group '%s' and retrieving group information from the usenet server\n", group)
+	var (
+		selected *searchRange
+		err      error
+	)
+	for _, p := range s.pools {
+		r, scanErr := s.scanRange(ctx, p, group)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if scanErr != nil {
+			s.debugf("Error while scanning group '%s' on server %s: %v\n", group, p.server, scanErr)
+			err = scanErr
+			continue
+		}
+		if r.complete {
+			selected = r
+			break
+		}
+		s.debugf("Server %s does not cover the whole search range in group '%s'\n", p.server, group)
+		if selected == nil || r.firstDate.Before(selected.firstDate) {
+			selected = r
+		}
+	}
+	if selected == nil {
+		s.logf("Error while scanning group '%s': %v\n", group, err)
+		return nil, err
+	}
+	return selected, nil
+}
+
+// searchRange is the range of messages to search in a group on a server.
+type searchRange struct {
+	pool           *pool
+	firstMessageID int
+	firstDate      time.Time
+	lastMessageID  int
+	lastDate       time.Time
+	// complete is false if the oldest message of the group on the server
+	// is newer than the start of the search range.
+	complete bool
+}
+
+// scanRange scans group on the server of p for the messages to start and
+// end the search.
+func (s *Searcher) scanRange(ctx context.Context, p *pool, group string) (*searchRange, error) {
+	r := &searchRange{pool: p}
+	err := s.withRetry(ctx, fmt.Sprintf("scanning group '%s' for the search range", group), func() error {
+		return p.request(ctx, group, func(conn *conn) (err error) {
+			first, last := conn.firstMessageID, conn.lastMessageID
+			s.debugf("First / last message in group '%s' are: %d | %d\n", group, first, last)
+			s.debugf("Scanning group '%s' for the last message to end the search\n", group)
+			end, err := s.scanForDate(conn, first, last, s.opts.To, false)
+			if err != nil {
+				return fmt.Errorf("error while scanning for the last message: %w", err)
+			}
+			r.lastMessageID, r.lastDate = end.Number, end.Date
+			s.debugf("Last message in group '%s' to end the search is %d, uploaded on %s (found with %d probes)\n", group, end.Number, end.Date, end.Probes)
+			s.debugf("Scanning group '%s' for the first message to start the search\n", group)
+			start, err := s.scanForDate(conn, first, r.lastMessageID, s.opts.From, true)
+			if err != nil {
+				return fmt.Errorf("error while scanning for the first message: %w", err)
+			}
+			r.firstMessageID, r.firstDate = start.Number, start.Date
+			s.debugf("First message in group '%s' to start the search was found with %d probes\n", group, start.Probes)
+			r.complete = r.firstMessageID > first
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SearchMessages retrieves the overview of the messages firstMessage to
+// lastMessage in group and collects all messages matching the header. If
+// the server used for group fails, the messages posted at the same time are
+// retrieved from the other servers.
+func (s *Searcher) SearchMessages(ctx context.Context, firstMessage int, lastMessage int, group string) error {
+	p := s.groupPool(group)
+	// messages all in the index are searched without a connection
+	results, indexed, err := s.indexedOverviews(p, group, firstMessage, lastMessage)
+	if !indexed && err == nil {
+		err = s.withRetry(ctx, fmt.Sprintf("retrieving message overview from messages %d to %d in group '%s'", firstMessage, lastMessage, group), func() error {
+			return p.request(ctx, group, func(conn *conn) (err error) {
+				first, last := firstMessage, lastMessage
+				if first < conn.firstMessageID {
+					first = conn.firstMessageID
+				}
+				if last > conn.lastMessageID {
+					last = conn.lastMessageID
+				}
+				s.debugf("Loading message overview from messages %d to %d in group '%s'\n", first, last, group)
+				results, err = s.overview(conn, first, last)
+				return err
+			})
+		})
+	}
+	if err != nil && !isNoArticles(err) && ctx.Err() == nil && len(s.pools) > 1 {
+		s.logf("Error retrieving message overview from messages %d to %d in group '%s' from server %s: %v\n", firstMessage, lastMessage, group, p.server, err)
+		if failoverResults, failoverErr := s.failover(ctx, group, p, Range{First: firstMessage, Last: lastMessage}); failoverErr == nil {
+			results, err = failoverResults, nil
+		}
+	}
+	if isNoArticles(err) {
+		s.mutex.Lock()
+		s.addCompletedRange(group, Range{First: firstMessage, Last: lastMessage})
+		s.mutex.Unlock()
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		s.logf("Error retrieving message overview from the usenet server while searching in group '%s': %v\n", group, err)
+		s.addFailedRange(group, Range{First: firstMessage, Last: lastMessage})
+		return err
+	}
+	// the results of the batch and the range searched must be saved together
+	s.batchMutex.RLock()
+	defer s.batchMutex.RUnlock()
+	defer func() {
+		s.mutex.Lock()
+		s.addCompletedRange(group, Range{First: firstMessage, Last: lastMessage})
+		s.mutex.Unlock()
+	}()
+	postDateUnix := s.opts.To.Unix()
+	for _, overview := range results {
+		currentDate := overview.Date.Unix()
+		if currentDate >= postDateUnix {
+			return nil
+		}
+		var message Message
+		message.MessageNo = overview.MessageNumber
+		message.Subject = html.UnescapeString(strings.ToValidUTF8(overview.Subject, ""))
+		message.MessageId = strings.Trim(overview.MessageId, "<>")
+		message.From = strings.ToValidUTF8(overview.From, "")
+		message.Bytes = overview.Bytes
+		if date := overview.Date.Unix(); date > 0 {
+			message.Date = date
+		}
+		message.FileNo = 1
+		message.TotalFiles = 1
+		message.SegmentNo = 1
+		message.TotalSegments = 1
+		message.Newsgroups = xrefGroups(overview.Extra)
+		if err := s.ParseSubject(&message, group); err != nil {
+			// message probably did not contain a yEnc encoded file?
+			s.debugf("Parsing error while searching in group '%s': %v\n", group, err)
+		}
+		atomic.AddUint64(&s.counter, 1)
+	}
+	return nil
+}
+
+// failover retrieves the overviews of the messages posted at the time of
+// the messages r of group on the server of failed from the other servers in
+// order of their priority. As the article numbers differ between servers,
+// the dates of r are interpolated from the search range of group, widened
+// by one step on both sides. Messages already found are left out.
+func (s *Searcher) failover(ctx context.Context, group string, failed *pool, r Range) ([]nntp.MessageOverview, error) {
+	s.mutex.Lock()
+	groupState, ok := s.groupStates[group]
+	var from, to time.Time
+	if ok {
+		from = interpolateDate(groupState, r.First-s.opts.Step)
+		to = interpolateDate(groupState, r.Last+s.opts.Step)
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return nil, errors.New("no search range of the group known")
+	}
+	if from.Before(s.opts.From) {
+		from = s.opts.From
+	}
+	if to.After(s.opts.To) {
+		to = s.opts.To
+	}
+	err := errors.New("no other server available")
+	for _, p := range s.pools {
+		if p == failed {
+			continue
+		}
+		var results []nntp.MessageOverview
+		description := fmt.Sprintf("retrieving message overview of messages from %s to %s in group '%s' from server %s", from, to, group, p.server)
+		requestErr := s.withRetry(ctx, description, func() error {
+			results = nil
+			return p.request(ctx, group, func(c *conn) error {
+				start, err := s.scanForDate(c, c.firstMessageID, c.lastMessageID, from, true)
+				if err != nil {
+					return err
+				}
+				end, err := s.scanForDate(c, start.Number, c.lastMessageID, to, false)
+				if err != nil {
+					return err
+				}
+				for first := start.Number; first <= end.Number; first += s.opts.Step + 1 {
+					last := first + s.opts.Step
+					if last > end.Number {
+						last = end.Number
+					}
+					overviews, err := s.overview(c, first, last)
+					if err != nil && !isNoArticles(err) {
+						return err
+					}
+					results = append(results, overviews...)
+				}
+				return nil
+			})
+		})
+		if requestErr == nil {
+			s.logf("Retrieved the messages posted from %s to %s in group '%s' from server %s instead\n", from, to, group, p.server)
+			return s.newOverviews(group, results), nil
+		}
+		s.logf("Error retrieving the messages posted from %s to %s in group '%s' from server %s: %v\n", from, to, group, p.server, requestErr)
+		err = requestErr
+	}
+	return nil, err
+}
+
+// interpolateDate returns the estimated date of message number in the
+// search range of groupState.
+func interpolateDate(groupState *GroupState, number int) time.Time {
+	if groupState.Last <= groupState.First {
+		return groupState.FirstDate
+	}
+	span := groupState.LastDate.Sub(groupState.FirstDate)
+	return groupState.FirstDate.Add(time.Duration(float64(span) * float64(number-groupState.First) / float64(groupState.Last-groupState.First))).Round(time.Second)
+}
+
+// newOverviews returns the overviews of messages not found yet in group.
+func (s *Searcher) newOverviews(group string, overviews []nntp.MessageOverview) []nntp.MessageOverview {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	found := make(map[string]bool)
+	for _, hdr := range s.headersByGroupAndHeaderHash[group] {
+		for _, f := range hdr.FilesByHash {
+			for _, msg := range f.Messages {
+				found[msg.MessageId] = true
+			}
+		}
+	}
+	var results []nntp.MessageOverview
+	for _, overview := range overviews {
+		if !found[strings.Trim(overview.MessageId, "<>")] {
+			results = append(results, overview)
+		}
+	}
+	return results
+}
@@ -0,0 +1,369 @@
+package searcher
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tensai75/nzbsearcher/internal/nntptest"
+)
+
+var testStart = time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	testGroup      = "alt.binaries.test"
+	testCrossGroup = "alt.binaries.test2"
+)
+
+// newTestStore returns a store with 3000 random articles posted every 5
+// minutes from testStart on and, in the middle, a post of 3 files of 3
+// segments each, cross-posted to testCrossGroup.
+func newTestStore() (*nntptest.Store, []*nntptest.Article) {
+	store := nntptest.NewStore()
+	store.AddFiller(testGroup, 1, 1500, testStart, 5*time.Minute)
+	var files []nntptest.PostFile
+	for i := 1; i <= 3; i++ {
+		data := make([]byte, 2500)
+		for j := range data {
+			data[j] = byte(i * j)
+		}
+		files = append(files, nntptest.PostFile{Name: fmt.Sprintf("my.show.s01e01.part%d.rar", i), Data: data})
+	}
+	post := store.AddPost(testGroup, nntptest.Post{
+		Header:   "My.Show.S01E01.720p",
+		Files:    files,
+		Date:     testStart.Add(1500 * 5 * time.Minute),
+		Interval: time.Second,
+		Groups:   []string{testGroup, testCrossGroup},
+	})
+	store.AddFiller(testGroup, 2, 1500, testStart.Add(1501*5*time.Minute), 5*time.Minute)
+	return store, post
+}
+
+// newTestSearcher returns a Searcher for a server serving store, searching
+// for the header from one day before to one day after the post.
+func newTestSearcher(t *testing.T, store *nntptest.Store, header string) (*Searcher, *nntptest.Server) {
+	server, err := nntptest.NewUnstartedServer(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.User, server.Password = "user", "secret"
+	server.Start()
+	t.Cleanup(server.Close)
+	postDate := testStart.Add(1500 * 5 * time.Minute)
+	s, err := New(Options{
+		Servers: []Server{{
+			Host:        server.Host(),
+			Port:        server.Port(),
+			User:        "user",
+			Password:    "secret",
+			Connections: 4,
+		}},
+		Headers:       []string{header},
+		From:          postDate.Add(-24 * time.Hour),
+		To:            postDate.Add(24 * time.Hour),
+		Step:          100,
+		ScanTolerance: 50,
+		Retries:       3,
+		RetryDelay:    time.Millisecond,
+		Logf:          func(format string, v ...interface{}) { t.Logf(format, v...) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s, server
+}
+
+// checkPost checks that headers are the headers of the post of the test
+// store.
+func checkPost(t *testing.T, headers []*Header) {
+	t.Helper()
+	if len(headers) != 1 {
+		t.Fatalf("found %d headers, want 1", len(headers))
+	}
+	hdr := headers[0]
+	completeness := hdr.Completeness()
+	if !completeness.Complete() || completeness.Files != 3 || completeness.Segments != 9 {
+		t.Errorf("header '%s' is %s, want 3/3 files and 9/9 segments", hdr.Name, completeness)
+	}
+	for _, f := range hdr.FilesByHash {
+		if len(f.Groups) != 2 || f.Groups[0] != testGroup || f.Groups[1] != testCrossGroup {
+			t.Errorf("file '%s' was posted to %v, want %s and %s", f.Name, f.Groups, testGroup, testCrossGroup)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	store, _ := newTestStore()
+	s, _ := newTestSearcher(t, store, "my.show AND 720p")
+	headers, err := s.Search(context.Background(), testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPost(t, headers)
+	if failed := s.FailedRanges()[testGroup]; len(failed) > 0 {
+		t.Errorf("failed ranges %v", failed)
+	}
+}
+
+func TestSearchFaults(t *testing.T) {
+	store, _ := newTestStore()
+	s, server := newTestSearcher(t, store, "My.Show")
+	server.Inject(nntptest.Fault{Command: "OVER", Times: 2, Code: 436, Message: "temporary failure"})
+	server.Inject(nntptest.Fault{Command: "GROUP", Times: 1, Drop: true})
+	server.Inject(nntptest.Fault{Command: "OVER", Times: 5, Delay: 20 * time.Millisecond})
+	headers, err := s.Search(context.Background(), testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPost(t, headers)
+	if failed := s.FailedRanges()[testGroup]; len(failed) > 0 {
+		t.Errorf("failed ranges %v after temporary failures", failed)
+	}
+}
+
+// postBatch returns the range of the search containing the first segment
+// of the post.
+func postBatch(t *testing.T, s *Searcher, first *nntptest.Article) Range {
+	t.Helper()
+	start, err := s.ScanForDate(context.Background(), testGroup, s.opts.From, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	number := start.Number
+	for number+s.opts.Step+1 <= first.Number {
+		number += s.opts.Step + 1
+	}
+	return Range{First: number, Last: number + s.opts.Step}
+}
+
+func TestSearchPermanentFailure(t *testing.T) {
+	store, post := newTestStore()
+	s, server := newTestSearcher(t, store, "My.Show")
+	failed := postBatch(t, s, post[0])
+	server.Inject(nntptest.Fault{Command: "OVER", Args: failed.String(), Code: 502, Message: "permission denied"})
+	headers, err := s.Search(context.Background(), testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.FailedRanges()[testGroup]; len(got) != 1 || got[0] != failed {
+		t.Errorf("failed ranges %v, want %v", got, failed)
+	}
+	// the post lies within the failed range
+	if len(headers) != 0 {
+		t.Errorf("found %d headers, want none", len(headers))
+	}
+}
+
+func TestSearchExpired(t *testing.T) {
+	store, post := newTestStore()
+	store.Expire(post[4].MessageID)
+	s, _ := newTestSearcher(t, store, "My.Show")
+	headers, err := s.Search(context.Background(), testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 1 {
+		t.Fatalf("found %d headers, want 1", len(headers))
+	}
+	completeness := headers[0].Completeness()
+	if completeness.Segments != 8 || completeness.TotalSegments != 9 {
+		t.Errorf("header is %s, want 8/9 segments", completeness)
+	}
+	availability, err := s.Verify(context.Background(), headers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range availability {
+		if f.Available != f.Segments || len(f.Missing) > 0 {
+			t.Errorf("file '%s': %s, want all found segments available", f.Name, f)
+		}
+	}
+}
+
+func TestScanForDate(t *testing.T) {
+	store := nntptest.NewStore()
+	store.AddFiller(testGroup, 3, 5000, testStart, time.Minute)
+	articles := store.Articles(testGroup)
+	var expired []string
+	for _, a := range articles[2000:2600] {
+		expired = append(expired, a.MessageID)
+	}
+	store.Expire(expired...)
+	s, _ := newTestSearcher(t, store, "none")
+
+	// firstAfter returns the number of the first article not expired posted
+	// after date, or of the last article if there is none
+	firstAfter := func(date time.Time) int {
+		last := 0
+		for _, a := range articles {
+			if a.Expired {
+				continue
+			}
+			if a.Date.After(date) {
+				return a.Number
+			}
+			last = a.Number
+		}
+		return last
+	}
+	tests := []struct {
+		name  string
+		date  time.Time
+		first bool
+		err   bool
+	}{
+		{name: "before first message", date: testStart.Add(-time.Hour), first: true},
+		{name: "before first message, not allowed", date: testStart.Add(-time.Hour), err: true},
+		{name: "first messages", date: testStart.Add(30 * time.Second), first: true},
+		{name: "middle", date: testStart.Add(1234*time.Minute + 30*time.Second)},
+		{name: "before expired messages", date: testStart.Add(1999*time.Minute + 30*time.Second)},
+		{name: "in expired messages", date: testStart.Add(2300 * time.Minute)},
+		{name: "after expired messages", date: testStart.Add(2700*time.Minute + 30*time.Second)},
+		{name: "end", date: testStart.Add(4998*time.Minute + 30*time.Second)},
+		{name: "after last message", date: testStart.Add(6000 * time.Minute)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			boundary, err := s.ScanForDate(context.Background(), testGroup, test.date, test.first)
+			if test.err {
+				if err == nil {
+					t.Fatalf("found message %d, want error", boundary.Number)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := firstAfter(test.date); boundary.Number != want {
+				t.Errorf("found message %d with %d probes, want %d", boundary.Number, boundary.Probes, want)
+			}
+		})
+	}
+}
+
+func TestSearchSingleFile(t *testing.T) {
+	// a single file posted without a file counter
+	store := nntptest.NewStore()
+	store.AddFiller(testGroup, 1, 1500, testStart, 5*time.Minute)
+	postDate := testStart.Add(1500 * 5 * time.Minute)
+	data := make([]byte, 1500)
+	for part := 1; part <= 2; part++ {
+		begin, end := (part-1)*1000, part*1000
+		if end > len(data) {
+			end = len(data)
+		}
+		store.Add(testGroup, &nntptest.Article{
+			Subject: fmt.Sprintf(`"abc.mkv" yEnc (%d/2)`, part),
+			Date:    postDate.Add(time.Duration(part) * time.Second),
+			Body:    nntptest.EncodeYEnc("abc.mkv", data[begin:end], part, 2, int64(begin), int64(len(data))),
+		})
+	}
+	store.AddFiller(testGroup, 2, 1500, testStart.Add(1501*5*time.Minute), 5*time.Minute)
+	s, _ := newTestSearcher(t, store, "abc")
+	headers, err := s.Search(context.Background(), testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 1 {
+		t.Fatalf("found %d headers, want 1", len(headers))
+	}
+	completeness := headers[0].Completeness()
+	if !completeness.Complete() || completeness.Files != 1 || completeness.TotalFiles != 1 || completeness.Segments != 2 {
+		t.Errorf("header '%s' is %s, want 1/1 files and 2/2 segments", headers[0].Name, completeness)
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	store, _ := newTestStore()
+	s, server := newTestSearcher(t, store, "My.Show")
+	index, err := OpenIndex(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { index.Close() })
+	opts := s.opts
+	opts.Index = index
+	for i, name := range []string{"online", "offline"} {
+		commands := len(server.Commands())
+		s, err := New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers, err := s.Search(context.Background(), testGroup)
+		s.Close()
+		if err != nil {
+			t.Fatalf("%s search: %v", name, err)
+		}
+		checkPost(t, headers)
+		// the second search is done from the index alone
+		if n := len(server.Commands()) - commands; i == 1 && n > 0 {
+			t.Errorf("%s search sent %d commands to the server, want none", name, n)
+		}
+	}
+}
+
+func TestSearchWrongPassword(t *testing.T) {
+	store, _ := newTestStore()
+	s, server := newTestSearcher(t, store, "My.Show")
+	opts := s.opts
+	opts.Servers = []Server{opts.Servers[0]}
+	opts.Servers[0].Password = "wrong"
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Search(context.Background(), testGroup); err == nil {
+		t.Fatal("search succeeded with wrong password")
+	}
+	// authentication errors are not retried
+	if n := server.CountCommands("AUTHINFO"); n != 2 {
+		t.Errorf("sent %d AUTHINFO commands, want 2", n)
+	}
+}
+
+func TestSearchFailover(t *testing.T) {
+	store, post := newTestStore()
+	s, server := newTestSearcher(t, store, "My.Show")
+	// the second server carries the same articles with other numbers
+	backup := nntptest.NewStore()
+	backup.AddFiller(testGroup, 4, 700, testStart.Add(-30*24*time.Hour), time.Hour)
+	for _, a := range store.Articles(testGroup) {
+		article := *a
+		article.Number += 1000
+		backup.Add(testGroup, &article)
+	}
+	backupServer, err := nntptest.NewServer(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(backupServer.Close)
+	opts := s.opts
+	opts.Servers = []Server{opts.Servers[0], {Host: backupServer.Host(), Port: backupServer.Port(), Connections: 2, Priority: 1}}
+	failed := postBatch(t, s, post[0])
+	server.Inject(nntptest.Fault{Command: "OVER", Args: failed.String(), Code: 502, Message: "permission denied"})
+	s, err = New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	headers, err := s.Search(context.Background(), testGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPost(t, headers)
+	if got := s.FailedRanges()[testGroup]; len(got) > 0 {
+		t.Errorf("failed ranges %v after failover", got)
+	}
+	for _, f := range headers[0].FilesByHash {
+		for _, msg := range f.Messages {
+			if msg.MessageNo < 1000 {
+				t.Errorf("message <%s> found on the failed server", msg.MessageId)
+			}
+		}
+	}
+}
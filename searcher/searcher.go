@@ -0,0 +1,261 @@
+// Package searcher implements a search engine that looks for a header
+// directly in the message overviews of one or more Usenet groups and
+// collects the found messages so NZB files can be generated from them.
+package searcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server holds the settings needed to connect to a Usenet server.
+type Server struct {
+	Host     string
+	Port     int
+	SSL      bool
+	User     string
+	Password string
+	// Connections is the maximum number of connections to the server.
+	Connections int
+	// Priority determines the order in which the servers are tried.
+	// Servers with a lower value are tried first.
+	Priority int
+}
+
+// Options configures a Searcher.
+type Options struct {
+	// Servers are the Usenet servers to search on.
+	Servers []Server
+	// Headers are the search queries for the headers, see Query for the
+	// syntax. All queries are matched in a single pass over the messages.
+	// A header without the operators AND, OR and NOT, double quotes and
+	// regular expressions or which is not a valid query is searched for
+	// literally.
+	Headers []string
+	// From and To are the start and the end of the date range to search.
+	// Messages posted at or after To are not searched. A Searcher without
+	// a date range cannot search, but can be used to verify articles.
+	From time.Time
+	To   time.Time
+	// Filter restricts the headers returned by the search.
+	Filter Filter
+	// Parser parses the subjects of the messages. DefaultParser is used if
+	// nil. With DebugParser the rule every subject was parsed with is
+	// logged.
+	Parser      SubjectParser
+	DebugParser bool
+	// Step is the number of message headers to retrieve in one header
+	// overview request.
+	Step int
+	// ParallelScans is the number of groups to scan in parallel.
+	ParallelScans int
+	// ScanTolerance is the maximum number of messages scanned one by one
+	// when scanning a group for the messages to start and end the search.
+	ScanTolerance int
+	// Retries is the number of times a failed request is repeated.
+	Retries int
+	// RetryDelay is the initial delay before a failed request is
+	// repeated. It is doubled with every retry up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// StateFile is the file the state of the search is saved to every
+	// CheckpointInterval. No state is saved if empty.
+	StateFile          string
+	CheckpointInterval time.Duration
+	// Index is the local index of message overviews to use. Overviews not
+	// in the index are retrieved from the server and added to the index.
+	// No index is used if nil.
+	Index *Index
+	// DateCache is the cache of message dates used to speed up the scan
+	// for the messages to start and end the search. No cache is used if
+	// nil.
+	DateCache *DateCache
+	// Resume is the state of an earlier search to resume. The search
+	// parameters must be the same as those of the earlier search.
+	Resume *State
+	// Verbose enables additional progress output.
+	Verbose bool
+	// Logf receives all progress and error output. If nil, output is
+	// discarded.
+	Logf func(format string, v ...interface{})
+}
+
+// GroupResult is the result of the search in one group.
+type GroupResult struct {
+	Group   string
+	Headers []*Header
+	// FailedRanges are the article ranges which could not be retrieved
+	// from the server. The headers may be incomplete if not empty.
+	FailedRanges []Range
+	// Server is the server the group was searched on.
+	Server Server
+	// Partial is true if the search was interrupted before it finished.
+	Partial bool
+	Err     error
+}
+
+// Searcher searches Usenet groups for headers.
+type Searcher struct {
+	opts    Options
+	queries *querySet
+	filter  *compiledFilter
+	parser  SubjectParser
+
+	counter uint64
+	pools   []*pool
+
+	// batchMutex is held for reading while the results of a batch are
+	// processed and for writing while the state of the search is saved
+	batchMutex sync.RWMutex
+
+	mutex                       sync.Mutex
+	headersByGroupAndHeaderHash map[string]map[string]*Header
+	failedRanges                map[string][]Range
+	poolsByGroup                map[string]*pool
+	groupStates                 map[string]*GroupState
+}
+
+// New returns a Searcher for the given options.
+func New(opts Options) (*Searcher, error) {
+	if len(opts.Servers) == 0 {
+		return nil, errors.New("no usenet server given")
+	}
+	for _, server := range opts.Servers {
+		if server.Host == "" {
+			return nil, errors.New("no usenet server host given")
+		}
+	}
+	if !opts.From.IsZero() || !opts.To.IsZero() {
+		if !opts.From.Before(opts.To) {
+			return nil, errors.New("the start of the date range must be before its end")
+		}
+		if opts.Step < 1 {
+			return nil, errors.New("step must be greater than 0")
+		}
+	}
+	if opts.ParallelScans < 1 {
+		opts.ParallelScans = 1
+	}
+	if opts.ScanTolerance < 1 {
+		opts.ScanTolerance = defaultScanTolerance
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = defaultRetryDelay
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = defaultMaxRetryDelay
+	}
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = defaultCheckpointInterval
+	}
+	s := &Searcher{
+		opts:                        opts,
+		pools:                       newPools(opts.Servers),
+		poolsByGroup:                make(map[string]*pool),
+		headersByGroupAndHeaderHash: make(map[string]map[string]*Header),
+		failedRanges:                make(map[string][]Range),
+		groupStates:                 make(map[string]*GroupState),
+	}
+	s.filter = compileFilter(opts.Filter)
+	s.parser = opts.Parser
+	if s.parser == nil {
+		s.parser = DefaultParser
+	}
+	s.queries = newQuerySet(opts.Headers, func(header string, err error) {
+		s.logf("The header '%s' is not a valid query and is searched for literally: %v\n", header, err)
+	})
+	if opts.Resume != nil {
+		if err := s.resume(opts.Resume); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// SearchGroups searches all groups, running up to ParallelScans searches
+// in parallel. handle is called once for every group as soon as the search
+// in that group has finished. It may be called concurrently.
+// If ctx is done, no further groups are searched and the running searches
+// are interrupted, with handle being called with their partial results.
+func (s *Searcher) SearchGroups(ctx context.Context, groups []string, handle func(GroupResult)) {
+	if s.opts.StateFile != "" {
+		checkpointCtx, stopCheckpoints := context.WithCancel(ctx)
+		go s.checkpoint(checkpointCtx, groups)
+		defer func() {
+			stopCheckpoints()
+			s.saveState(groups)
+		}()
+	}
+	var wg sync.WaitGroup
+	guard := make(chan struct{}, s.opts.ParallelScans)
+	for _, group := range groups {
+		select {
+		case guard <- struct{}{}: // will block if guard channel is already filled
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(group string) {
+			defer func() {
+				wg.Done()
+				<-guard
+			}()
+			headers, err := s.Search(ctx, group)
+			handle(GroupResult{
+				Group:        group,
+				Headers:      headers,
+				FailedRanges: s.FailedRanges()[group],
+				Server:       s.GroupServers()[group],
+				Partial:      ctx.Err() != nil && errors.Is(err, ctx.Err()),
+				Err:          err,
+			})
+		}(group)
+	}
+	wg.Wait()
+}
+
+// Close closes all connections to the usenet server kept open for reuse.
+func (s *Searcher) Close() {
+	for _, p := range s.pools {
+		p.close()
+	}
+}
+
+// Results returns the headers found so far, keyed by group. The headers are
+// not filtered.
+func (s *Searcher) Results() map[string][]*Header {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	results := make(map[string][]*Header, len(s.headersByGroupAndHeaderHash))
+	for group, headers := range s.headersByGroupAndHeaderHash {
+		for _, hdr := range headers {
+			results[group] = append(results[group], hdr)
+		}
+	}
+	return results
+}
+
+// Processed returns the number of messages processed so far.
+func (s *Searcher) Processed() uint64 {
+	return atomic.LoadUint64(&s.counter)
+}
+
+func (s *Searcher) logf(format string, v ...interface{}) {
+	if s.opts.Logf != nil {
+		s.opts.Logf(format, v...)
+	}
+}
+
+func (s *Searcher) debugf(format string, v ...interface{}) {
+	if s.opts.Verbose {
+		s.logf(format, v...)
+	}
+}
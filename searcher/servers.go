@@ -0,0 +1,54 @@
+package searcher
+
+import (
+	"sort"
+	"strconv"
+)
+
+func (server Server) String() string {
+	return server.Host + ":" + strconv.Itoa(server.Port)
+}
+
+// newPools returns a connection pool for every server, sorted by the
+// priority of the servers.
+func newPools(servers []Server) []*pool {
+	pools := make([]*pool, len(servers))
+	for i, server := range servers {
+		if server.Connections < 1 {
+			server.Connections = 1
+		}
+		pools[i] = newPool(server)
+	}
+	sort.SliceStable(pools, func(i, j int) bool {
+		return pools[i].server.Priority < pools[j].server.Priority
+	})
+	return pools
+}
+
+// groupPool returns the pool of the server used for group, or the pool of
+// the server with the highest priority if no server was selected yet.
+func (s *Searcher) groupPool(group string) *pool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if p, ok := s.poolsByGroup[group]; ok {
+		return p
+	}
+	return s.pools[0]
+}
+
+func (s *Searcher) setGroupPool(group string, p *pool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.poolsByGroup[group] = p
+}
+
+// GroupServers returns the server used for each group searched so far.
+func (s *Searcher) GroupServers() map[string]Server {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	servers := make(map[string]Server, len(s.poolsByGroup))
+	for group, p := range s.poolsByGroup {
+		servers[group] = p.server
+	}
+	return servers
+}
@@ -0,0 +1,130 @@
+package searcher
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strconv"
+)
+
+// Header is a post found by the search, i.e. a set of files sharing the
+// same header.
+type Header struct {
+	Name string
+	Hash string
+	// Query is the search query the header was found with.
+	Query       string
+	FilesByHash map[string]*File
+}
+
+// Message holds the information of one message (i.e. one segment of a file)
+// taken from the message overview and parsed from its subject.
+type Message struct {
+	MessageNo     int
+	Subject       string
+	MessageId     string
+	From          string
+	Bytes         int
+	Date          int64
+	Header        string
+	Filename      string
+	Basefilename  string
+	FileNo        int
+	TotalFiles    int
+	SegmentNo     int
+	TotalSegments int
+	// Newsgroups are the groups the message was cross-posted to according
+	// to its Xref header, if known.
+	Newsgroups []string `json:",omitempty"`
+}
+
+// File is a file of a found post together with its messages.
+type File struct {
+	Name string
+	Hash string
+	// Size is the size of the file if known, e.g. from its yEnc header.
+	Size     int64 `json:",omitempty"`
+	Poster   string
+	Subject  string
+	Date     int64
+	Groups   []string
+	Number   int
+	Messages []Message
+}
+
+// ParseSubject parses the subject of msg with the subject parser and, if it
+// matches any of the headers searched for, adds the message to the results
+// for group, once for every matching query.
+func (s *Searcher) ParseSubject(msg *Message, group string) error {
+	queries := s.queries.match(msg.Subject)
+	if len(queries) == 0 {
+		return nil
+	}
+	parsed, err := s.parser.ParseSubject(msg.Subject, group)
+	if err != nil {
+		return err
+	}
+	if s.opts.DebugParser {
+		s.logf("Subject '%s' in group '%s' parsed with rule '%s': header '%s', file '%s' (%d/%d), segment %d/%d\n",
+			msg.Subject, group, parsed.Rule, parsed.Header, parsed.Filename, parsed.FileNo, parsed.TotalFiles, parsed.SegmentNo, parsed.TotalSegments)
+	}
+	msg.Header = parsed.Header
+	msg.Filename = parsed.Filename
+	msg.Basefilename = parsed.Basefilename
+	// the defaults of msg are kept for counters a parser did not find
+	if parsed.TotalFiles > 0 {
+		msg.FileNo = parsed.FileNo
+		msg.TotalFiles = parsed.TotalFiles
+	}
+	if parsed.TotalSegments > 0 {
+		msg.SegmentNo = parsed.SegmentNo
+		msg.TotalSegments = parsed.TotalSegments
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	headersByHash, ok := s.headersByGroupAndHeaderHash[group]
+	if !ok {
+		headersByHash = make(map[string]*Header)
+		s.headersByGroupAndHeaderHash[group] = headersByHash
+	}
+	for _, query := range queries {
+		// the results of every query are kept apart
+		headerHash := getMD5Hash(msg.Header + msg.From + strconv.Itoa(msg.TotalFiles))
+		if len(s.queries.queries) > 1 {
+			headerHash = getMD5Hash(query.String() + headerHash)
+		}
+		fileHash := getMD5Hash(headerHash + msg.Filename + strconv.Itoa(msg.TotalSegments))
+		hdr, ok := headersByHash[headerHash]
+		if !ok {
+			hdr = &Header{
+				Name:        msg.Header + " " + msg.Basefilename,
+				Hash:        headerHash,
+				Query:       query.String(),
+				FilesByHash: make(map[string]*File),
+			}
+			headersByHash[headerHash] = hdr
+		}
+		f, ok := hdr.FilesByHash[fileHash]
+		if !ok {
+			f = &File{
+				Name:     msg.Filename,
+				Hash:     fileHash,
+				Poster:   msg.From,
+				Number:   msg.FileNo,
+				Date:     msg.Date,
+				Subject:  msg.Subject,
+				Groups:   []string{group},
+				Messages: make([]Message, 0, 1),
+			}
+			hdr.FilesByHash[fileHash] = f
+		}
+		f.Groups = addGroups(f.Groups, msg.Newsgroups...)
+		f.Messages = append(f.Messages, *msg)
+	}
+	return nil
+}
+
+func getMD5Hash(text string) string {
+	hasher := md5.New()
+	hasher.Write([]byte(text))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
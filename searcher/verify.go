@@ -0,0 +1,143 @@
+package searcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FileAvailability is the availability of the articles of a file on the
+// servers.
+type FileAvailability struct {
+	// Name and Hash identify the file within its header.
+	Name string
+	Hash string
+	// Segments is the number of segments of the file, Available the number
+	// of segments available on at least one server.
+	Segments  int
+	Available int
+	// Missing are the numbers of the segments not available.
+	Missing []int
+}
+
+// Percent returns the share of the segments available in percent.
+func (a FileAvailability) Percent() float64 {
+	if a.Segments == 0 {
+		return 0
+	}
+	return float64(a.Available) / float64(a.Segments) * 100
+}
+
+// Complete reports whether all segments of the file are available.
+func (a FileAvailability) Complete() bool {
+	return a.Available == a.Segments
+}
+
+func (a FileAvailability) String() string {
+	s := fmt.Sprintf("%s: %d/%d segments available (%.1f%%)", a.Name, a.Available, a.Segments, a.Percent())
+	if len(a.Missing) > 0 {
+		s += fmt.Sprintf(", missing segments: %s", formatRanges(numberRanges(a.Missing)))
+	}
+	return s
+}
+
+// Verify checks with STAT requests whether the articles of all segments of
+// hdr are available on at least one of the servers and returns the
+// availability of every file, sorted by file name.
+func (s *Searcher) Verify(ctx context.Context, hdr *Header) ([]FileAvailability, error) {
+	var messageIDs []string
+	for _, f := range hdr.FilesByHash {
+		for _, msg := range f.Messages {
+			messageIDs = append(messageIDs, msg.MessageId)
+		}
+	}
+	available, err := s.Available(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	var files []FileAvailability
+	for _, f := range hdr.FilesByHash {
+		availability := FileAvailability{Name: f.Name, Hash: f.Hash}
+		segments := make(map[int]bool)
+		for _, msg := range f.Messages {
+			// a segment found more than once is available if any of its
+			// articles is
+			segments[msg.SegmentNo] = segments[msg.SegmentNo] || available[msg.MessageId]
+		}
+		for segment, ok := range segments {
+			availability.Segments++
+			if ok {
+				availability.Available++
+			} else {
+				availability.Missing = append(availability.Missing, segment)
+			}
+		}
+		sort.Ints(availability.Missing)
+		files = append(files, availability)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// Available checks with STAT requests which of the articles with the given
+// message ids are available on at least one of the servers. The servers are
+// tried in order of their priority and the articles are checked in parallel
+// using all connections of the servers.
+func (s *Searcher) Available(ctx context.Context, messageIDs []string) (map[string]bool, error) {
+	workers := 0
+	for _, p := range s.pools {
+		workers += cap(p.guard)
+	}
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		available = make(map[string]bool, len(messageIDs))
+		failed    error
+		ids       = make(chan string)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				ok, err := s.stat(ctx, id)
+				mutex.Lock()
+				if err != nil && failed == nil {
+					failed = err
+				}
+				available[id] = ok
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, id := range messageIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return available, ctx.Err()
+	}
+	return available, failed
+}
+
+// stat checks whether the article with the message id is available on any
+// of the servers. An error is only returned if the article is not available
+// and at least one server could not be asked.
+func (s *Searcher) stat(ctx context.Context, messageID string) (bool, error) {
+	err := s.onAnyServer(ctx, fmt.Sprintf("checking article <%s>", messageID), func(c *conn) error {
+		_, _, err := c.Stat("<" + messageID + ">")
+		return err
+	})
+	if err == nil {
+		return true, nil
+	}
+	if isNoSuchArticle(err) {
+		return false, nil
+	}
+	return false, err
+}
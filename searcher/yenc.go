@@ -0,0 +1,333 @@
+package searcher
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// maximum number of lines searched for the =ybegin line of an article
+	maxYEncHeaderLines = 10
+	// maximum size of a part preallocated when decoding, as the sizes in
+	// the yEnc header are not trusted
+	maxYEncBuffer = 4 << 20
+)
+
+// YEncHeader is the information of the =ybegin and =ypart lines of a yEnc
+// encoded article.
+type YEncHeader struct {
+	// Name and Size are the name and the size of the file encoded.
+	Name string
+	Size int64
+	// Part is the number of the part encoded in the article and Total the
+	// number of parts of the file. Both are 0 for single part files.
+	Part  int
+	Total int
+	// Begin and End are the offsets of the part within the file (starting
+	// at 1), both 0 for single part files.
+	Begin int64
+	End   int64
+}
+
+// ReadYEncHeader reads the =ybegin and =ypart lines from the start of the
+// body of a yEnc encoded article.
+func ReadYEncHeader(r *bufio.Reader) (*YEncHeader, error) {
+	for i := 0; i < maxYEncHeaderLines; i++ {
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "=ybegin ") {
+			return readYEncPart(r, parseYEncBegin(line))
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+	}
+	return nil, errors.New("no yEnc header found")
+}
+
+// parseYEncBegin parses a =ybegin line, e.g.
+// "=ybegin part=1 total=3 line=128 size=123456 name=file.rar". The name is
+// the rest of the line and may contain spaces.
+func parseYEncBegin(line string) *YEncHeader {
+	hdr := &YEncHeader{}
+	if i := strings.Index(line, " name="); i >= 0 {
+		hdr.Name = strings.TrimSpace(line[i+len(" name="):])
+		line = line[:i]
+	}
+	values := yEncValues(line)
+	hdr.Size, _ = strconv.ParseInt(values["size"], 10, 64)
+	hdr.Part, _ = strconv.Atoi(values["part"])
+	hdr.Total, _ = strconv.Atoi(values["total"])
+	return hdr
+}
+
+// readYEncPart reads the =ypart line following the =ybegin line of a part
+// of a multi part file.
+func readYEncPart(r *bufio.Reader, hdr *YEncHeader) (*YEncHeader, error) {
+	if hdr.Name == "" {
+		return nil, errors.New("no file name in yEnc header")
+	}
+	if hdr.Part == 0 {
+		return hdr, nil
+	}
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if line = strings.TrimRight(line, "\r\n"); strings.HasPrefix(line, "=ypart ") {
+		values := yEncValues(line)
+		hdr.Begin, _ = strconv.ParseInt(values["begin"], 10, 64)
+		hdr.End, _ = strconv.ParseInt(values["end"], 10, 64)
+	}
+	return hdr, nil
+}
+
+func yEncValues(line string) map[string]string {
+	values := make(map[string]string)
+	for _, field := range strings.Fields(line)[1:] {
+		if i := strings.Index(field, "="); i > 0 {
+			values[field[:i]] = field[i+1:]
+		}
+	}
+	return values
+}
+
+// yEncHeader retrieves the yEnc header of the article with the message id
+// from the servers in order of their priority. Only the start of the article
+// is read, the connection is closed afterwards.
+func (s *Searcher) yEncHeader(ctx context.Context, messageID string) (*YEncHeader, error) {
+	var hdr *YEncHeader
+	err := s.onAnyServer(ctx, fmt.Sprintf("reading yEnc header of article <%s>", messageID), func(c *conn) error {
+		body, err := c.Body("<" + messageID + ">")
+		if err != nil {
+			return err
+		}
+		hdr, err = ReadYEncHeader(bufio.NewReader(body))
+		// the rest of the article is not needed, closing the connection
+		// is faster than reading it
+		c.abandon()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hdr, nil
+}
+
+// releaseExtensions matches the extensions of the files of a release, e.g.
+// ".part01.rar", ".r00", ".vol00+01.par2" or ".7z.001".
+var releaseExtensions = regexp.MustCompile(`(?i)(\.(part\d+\.rar|rar|r\d{2,3}|vol\d+[+-]\d+\.par2|par2|7z|zip|\d{3}|nfo|sfv|nzb))+$`)
+
+// releaseName returns the name of the release the file belongs to, i.e.
+// the file name without the extensions of release files.
+func releaseName(filename string) string {
+	if name := releaseExtensions.ReplaceAllString(filename, ""); name != "" {
+		return name
+	}
+	return filename
+}
+
+// RecoverFilenames retrieves the yEnc header of the first segment of every
+// file of the headers and renames the files to the names given there. The
+// files renamed are grouped into headers by poster and release name, so
+// the files of obfuscated posts with random subjects are grouped correctly.
+// Files whose yEnc header cannot be retrieved remain in their header. The
+// headers passed are not modified.
+func (s *Searcher) RecoverFilenames(ctx context.Context, headers []*Header) []*Header {
+	yEncHeaders := s.yEncHeaders(ctx, headers)
+	var recovered []*Header
+	releases := make(map[string]*Header)
+	for _, hdr := range headers {
+		rest := &Header{Name: hdr.Name, Hash: hdr.Hash, Query: hdr.Query, FilesByHash: make(map[string]*File)}
+		for hash, f := range hdr.FilesByHash {
+			yenc, ok := yEncHeaders[f]
+			if !ok {
+				rest.FilesByHash[hash] = f
+				continue
+			}
+			if yenc.Name != f.Name {
+				s.debugf("Recovered name '%s' of file '%s'\n", yenc.Name, f.Name)
+			}
+			fileCopy := *f
+			fileCopy.Name = yenc.Name
+			fileCopy.Size = yenc.Size
+			fileCopy.Subject = renameSubject(f.Subject, f.Name, yenc.Name)
+			fileCopy.Messages = make([]Message, len(f.Messages))
+			for i, msg := range f.Messages {
+				msg.Filename = yenc.Name
+				msg.Subject = renameSubject(msg.Subject, f.Name, yenc.Name)
+				if yenc.Total > 0 {
+					msg.TotalSegments = yenc.Total
+				}
+				fileCopy.Messages[i] = msg
+			}
+			name := releaseName(yenc.Name)
+			key := hdr.Query + "\x00" + f.Poster + "\x00" + name
+			release, ok := releases[key]
+			if !ok {
+				release = &Header{Name: name, Hash: getMD5Hash(key), Query: hdr.Query, FilesByHash: make(map[string]*File)}
+				releases[key] = release
+				recovered = append(recovered, release)
+			}
+			release.FilesByHash[hash] = &fileCopy
+		}
+		if len(rest.FilesByHash) > 0 {
+			recovered = append(recovered, rest)
+		}
+	}
+	for _, hdr := range releases {
+		renumberFiles(hdr)
+	}
+	sort.Slice(recovered, func(i, j int) bool {
+		if recovered[i].Name != recovered[j].Name {
+			return recovered[i].Name < recovered[j].Name
+		}
+		return recovered[i].Hash < recovered[j].Hash
+	})
+	return recovered
+}
+
+// yEncHeaders retrieves the yEnc headers of the first segments of the files
+// of the headers in parallel using all connections of the servers. Files
+// whose yEnc header cannot be retrieved are missing from the result.
+func (s *Searcher) yEncHeaders(ctx context.Context, headers []*Header) map[*File]*YEncHeader {
+	workers := 0
+	for _, p := range s.pools {
+		workers += cap(p.guard)
+	}
+	var (
+		wg          sync.WaitGroup
+		mutex       sync.Mutex
+		yEncHeaders = make(map[*File]*YEncHeader)
+		files       = make(chan *File)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				first := f.Messages[0]
+				for _, msg := range f.Messages {
+					if msg.SegmentNo < first.SegmentNo {
+						first = msg
+					}
+				}
+				yenc, err := s.yEncHeader(ctx, first.MessageId)
+				if err != nil {
+					if ctx.Err() == nil {
+						s.logf("Error recovering the name of file '%s': %v\n", f.Name, err)
+					}
+					continue
+				}
+				mutex.Lock()
+				yEncHeaders[f] = yenc
+				mutex.Unlock()
+			}
+		}()
+	}
+	var list []*File
+	for _, hdr := range headers {
+		for _, f := range hdr.FilesByHash {
+			if len(f.Messages) > 0 {
+				list = append(list, f)
+			}
+		}
+	}
+	for _, f := range list {
+		if ctx.Err() != nil {
+			break
+		}
+		files <- f
+	}
+	close(files)
+	wg.Wait()
+	return yEncHeaders
+}
+
+// renumberFiles numbers the files of hdr in the order of their names, as
+// the numbers given in the subjects do not apply to files regrouped.
+func renumberFiles(hdr *Header) {
+	files := make([]*File, 0, len(hdr.FilesByHash))
+	for _, f := range hdr.FilesByHash {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	for i, f := range files {
+		f.Number = i + 1
+		for j := range f.Messages {
+			f.Messages[j].FileNo = i + 1
+			f.Messages[j].TotalFiles = len(files)
+		}
+	}
+}
+
+// renameSubject replaces the file name oldName in subject with newName, so
+// downloaders reading the name from the subject use the new name. If the
+// subject does not contain oldName, newName is put in front of it.
+func renameSubject(subject, oldName, newName string) string {
+	if oldName == newName {
+		return subject
+	}
+	if strings.Contains(subject, `"`+oldName+`"`) {
+		return strings.Replace(subject, `"`+oldName+`"`, `"`+newName+`"`, 1)
+	}
+	if oldName != "" && strings.Contains(subject, oldName) {
+		return strings.Replace(subject, oldName, newName, 1)
+	}
+	return `"` + newName + `" ` + subject
+}
+
+// DecodeYEnc decodes the body of a yEnc encoded article and returns its
+// yEnc header and the data of the part encoded.
+func DecodeYEnc(r io.Reader) (*YEncHeader, []byte, error) {
+	br := bufio.NewReader(r)
+	hdr, err := ReadYEncHeader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	size := hdr.Size
+	if hdr.End > hdr.Begin {
+		size = hdr.End - hdr.Begin + 1
+	}
+	if size <= 0 || size > maxYEncBuffer {
+		size = 0
+	}
+	data := make([]byte, 0, size)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			line = line[:len(line)-1]
+		}
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		if strings.HasPrefix(string(line), "=yend") {
+			return hdr, data, nil
+		}
+		for i := 0; i < len(line); i++ {
+			b := line[i]
+			if b == '=' && i+1 < len(line) {
+				i++
+				b = line[i] - 64
+			}
+			data = append(data, b-42)
+		}
+		if err == io.EOF {
+			return nil, nil, errors.New("missing =yend line")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
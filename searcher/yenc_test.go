@@ -0,0 +1,142 @@
+package searcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tensai75/nzbsearcher/internal/nntptest"
+)
+
+func TestReadYEncHeader(t *testing.T) {
+	tests := []struct {
+		body string
+		want *YEncHeader
+		err  bool
+	}{
+		{
+			body: "=ybegin part=2 total=3 line=128 size=2500 name=my file.rar\r\n=ypart begin=1001 end=2000\r\n",
+			want: &YEncHeader{Name: "my file.rar", Size: 2500, Part: 2, Total: 3, Begin: 1001, End: 2000},
+		},
+		{
+			body: "\r\n=ybegin line=128 size=12 name=file.nfo\r\ndata\r\n",
+			want: &YEncHeader{Name: "file.nfo", Size: 12},
+		},
+		{body: "=ybegin part=1 line=128 size=12\r\n", err: true},
+		{body: "no yEnc\r\n", err: true},
+		{body: "", err: true},
+	}
+	for _, test := range tests {
+		hdr, err := ReadYEncHeader(bufio.NewReader(strings.NewReader(test.body)))
+		if test.err {
+			if err == nil {
+				t.Errorf("ReadYEncHeader(%q) returned %+v, want error", test.body, hdr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadYEncHeader(%q) returned error %v", test.body, err)
+		} else if *hdr != *test.want {
+			t.Errorf("ReadYEncHeader(%q) returned %+v, want %+v", test.body, hdr, test.want)
+		}
+	}
+}
+
+func TestDecodeYEnc(t *testing.T) {
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	hdr, decoded, err := DecodeYEnc(bytes.NewReader(nntptest.EncodeYEnc("file.bin", data[1000:2000], 2, 3, 1000, 3000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Part != 2 || hdr.Begin != 1001 || hdr.End != 2000 || !bytes.Equal(decoded, data[1000:2000]) {
+		t.Errorf("DecodeYEnc returned header %+v and %d bytes, want part 2 of 1000 bytes", hdr, len(decoded))
+	}
+
+	tests := []struct {
+		name string
+		body string
+		err  bool
+	}{
+		{name: "negative size", body: "=ybegin line=128 size=-1 name=x.par2\r\nabc\r\n=yend size=3\r\n"},
+		{name: "huge size", body: "=ybegin line=128 size=999999999999999 name=x.par2\r\nabc\r\n=yend size=3\r\n"},
+		{name: "reversed part", body: "=ybegin part=1 line=128 size=10 name=x\r\n=ypart begin=9 end=-9223372036854775808\r\nabc\r\n=yend\r\n"},
+		{name: "missing end", body: "=ybegin line=128 size=3 name=x\r\nabc\r\n", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := DecodeYEnc(strings.NewReader(test.body))
+			if test.err != (err != nil) {
+				t.Errorf("DecodeYEnc returned error %v", err)
+			}
+		})
+	}
+}
+
+func FuzzDecodeYEnc(f *testing.F) {
+	f.Add(nntptest.EncodeYEnc("file.bin", []byte("some data =\r\n"), 1, 2, 0, 20))
+	f.Add(nntptest.EncodeYEnc("file.nfo", []byte("info"), 1, 1, 0, 4))
+	f.Add([]byte("=ybegin line=128 size=-1 name=x.par2\r\n=yend\r\n"))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		DecodeYEnc(bytes.NewReader(body))
+	})
+}
+
+func TestRecoverFilenames(t *testing.T) {
+	store, post := newTestStore()
+	s, server := newTestSearcher(t, store, "My.Show")
+	// the first segment of the third file is expired
+	store.Expire(post[6].MessageID)
+	const delay = 200 * time.Millisecond
+	server.Inject(nntptest.Fault{Command: "BODY", Delay: delay})
+	hdr := &Header{Name: "obfuscated", Hash: "obfuscated", FilesByHash: make(map[string]*File)}
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("%x.bin", i+10)
+		f := &File{Name: name, Hash: name, Poster: post[0].From, Number: i + 1}
+		for part := 1; part <= 3; part++ {
+			f.Messages = append(f.Messages, Message{
+				MessageId: post[i*3+part-1].MessageID,
+				Subject:   fmt.Sprintf(`[%d/3] - "%s" yEnc (%d/3)`, i+1, name, part),
+				Filename:  name,
+				SegmentNo: part,
+			})
+		}
+		hdr.FilesByHash[f.Hash] = f
+	}
+
+	start := time.Now()
+	recovered := s.RecoverFilenames(context.Background(), []*Header{hdr})
+	if elapsed := time.Since(start); elapsed >= 3*delay {
+		t.Errorf("recovering the names of 3 files took %v, want them retrieved in parallel", elapsed)
+	}
+	if len(recovered) != 2 {
+		t.Fatalf("recovered %d headers, want 2", len(recovered))
+	}
+	release, rest := recovered[0], recovered[1]
+	if release.Name != "my.show.s01e01" || len(release.FilesByHash) != 2 {
+		t.Errorf("recovered header '%s' with %d files, want 'my.show.s01e01' with 2 files", release.Name, len(release.FilesByHash))
+	}
+	for _, f := range release.FilesByHash {
+		want := fmt.Sprintf("my.show.s01e01.part%d.rar", f.Number)
+		if f.Name != want || f.Size != 2500 || !strings.Contains(f.Messages[0].Subject, `"`+want+`"`) {
+			t.Errorf("file %d recovered as '%s' of %d bytes with subject %q, want '%s' of 2500 bytes", f.Number, f.Name, f.Size, f.Messages[0].Subject, want)
+		}
+	}
+	if rest.Name != hdr.Name || len(rest.FilesByHash) != 1 || rest.FilesByHash["c.bin"] != hdr.FilesByHash["c.bin"] {
+		t.Errorf("file with the expired first segment not left in header '%s'", hdr.Name)
+	}
+	if n := server.CountCommands("BODY"); n != 3 {
+		t.Errorf("sent %d BODY commands, want 3", n)
+	}
+	// the connections the yEnc headers were read on are closed, only the
+	// one of the expired article is reused
+	if n := len(s.pools[0].idle); n != 1 {
+		t.Errorf("%d idle connections, want 1", n)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Tensai75/nzbsearcher/searcher"
+)
+
+// verifyHeader checks the availability of the articles of hdr and prints it
+// for every file. If files not completely available are to be dropped, it
+// returns a copy of hdr without these files or nil if no file is left.
+func verifyHeader(ctx context.Context, s *searcher.Searcher, hdr *searcher.Header) (*searcher.Header, []searcher.FileAvailability) {
+	if verbose {
+		fmt.Printf("Checking the availability of the articles of header '%s'\n", hdr.Name)
+	}
+	availability, err := s.Verify(ctx, hdr)
+	if err != nil {
+		fmt.Printf("Error checking the availability of the articles of header '%s': %v\n", hdr.Name, err)
+		return hdr, nil
+	}
+	for _, file := range availability {
+		fmt.Printf("  %s\n", file)
+	}
+	if !conf.DropUnavailable {
+		return hdr, availability
+	}
+	verified := &searcher.Header{
+		Name:        hdr.Name,
+		Hash:        hdr.Hash,
+		Query:       hdr.Query,
+		FilesByHash: make(map[string]*searcher.File),
+	}
+	var kept []searcher.FileAvailability
+	for _, file := range availability {
+		if !file.Complete() {
+			fmt.Printf("Removing file '%s' from the NZB file, not all articles are available\n", file.Name)
+			continue
+		}
+		verified.FilesByHash[file.Hash] = hdr.FilesByHash[file.Hash]
+		kept = append(kept, file)
+	}
+	if len(verified.FilesByHash) == 0 {
+		fmt.Printf("Not saving NZB file, no file of header '%s' is completely available\n", hdr.Name)
+		return nil, nil
+	}
+	return verified, kept
+}
+
+// exit codes of the verify command
+const (
+	verifyComplete   = 0
+	verifyIncomplete = 1
+	verifyError      = 2
+)
+
+// verifyNZBs checks the availability of the articles of the NZB files at
+// paths, prints a table with the availability of every file and returns the
+// exit code: 0 if all articles are available, 1 if articles are missing and
+// 2 if an NZB file could not be read or verified.
+func verifyNZBs(ctx context.Context, paths []string) int {
+	if len(paths) == 0 {
+		fmt.Printf("Usage: %s verify [flags] file.nzb [file.nzb ...]\n", filepath.Base(os.Args[0]))
+		return verifyError
+	}
+	s, err := searcher.New(searcher.Options{
+		Servers:    servers(),
+		Retries:    conf.Retries,
+		RetryDelay: conf.RetryDelay,
+		Verbose:    verbose,
+		Logf:       logf,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return verifyError
+	}
+	defer s.Close()
+	code := verifyComplete
+	for _, path := range paths {
+		hdr, err := readNZB(path)
+		if err != nil {
+			fmt.Printf("Error reading NZB file '%s': %v\n", path, err)
+			code = verifyError
+			continue
+		}
+		fmt.Printf("Checking the availability of the articles of NZB file '%s'\n", path)
+		availability, err := s.Verify(ctx, hdr)
+		if err != nil {
+			fmt.Printf("Error checking the availability of the articles of NZB file '%s': %v\n", path, err)
+			code = verifyError
+			continue
+		}
+		if !printAvailability(availability) && code == verifyComplete {
+			code = verifyIncomplete
+		}
+	}
+	return code
+}
+
+func readNZB(path string) (*searcher.Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return searcher.ReadNZB(f, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+}
+
+// printAvailability prints a table with the availability of the files and
+// reports whether all files are completely available.
+func printAvailability(availability []searcher.FileAvailability) bool {
+	var segments, available int
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSEGMENTS\tAVAILABLE\t%\tMISSING")
+	for _, file := range availability {
+		segments += file.Segments
+		available += file.Available
+		missing := make([]string, len(file.Missing))
+		for i, segment := range file.Missing {
+			missing[i] = strconv.Itoa(segment)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\n", file.Name, file.Segments, file.Available, file.Percent(), strings.Join(missing, ","))
+	}
+	total := searcher.FileAvailability{Name: "TOTAL", Segments: segments, Available: available}
+	fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t\n", total.Name, total.Segments, total.Available, total.Percent())
+	w.Flush()
+	return total.Complete()
+}